@@ -0,0 +1,267 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// ErrAuditBufferFull is returned by AsyncAuditSink when the event is dropped
+var ErrAuditBufferFull = errors.New("database: audit buffer is full")
+
+// AuditEvent is the record of a write statement
+type AuditEvent struct {
+	Time         time.Time     `json:"time"`
+	Statement    string        `json:"statement"`
+	Args         []interface{} `json:"args,omitempty"`
+	RowsAffected int64         `json:"rows_affected"`
+	Error        string        `json:"error,omitempty"`
+	Actor        string        `json:"actor,omitempty"`
+	RequestID    string        `json:"request_id,omitempty"`
+	TraceID      string        `json:"trace_id,omitempty"`
+}
+
+// AuditSink defines where the audit events go
+type AuditSink interface {
+	Write(AuditEvent) error
+}
+
+type (
+	actorKey     struct{}
+	requestIDKey struct{}
+)
+
+// ContextWithActor sets who makes the writes called with the returned context
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ContextWithRequestID sets the request the writes called with the returned context belong to
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// AuditWrapper defines an audit wrapper
+// which emits an AuditEvent to its sink for every exec
+type AuditWrapper struct {
+	sink   AuditSink
+	redact func(interface{}) interface{}
+	logger Logger
+}
+
+// AuditOption defines the audit wrapper's option
+type AuditOption func(*AuditWrapper)
+
+// WithAuditRedactor replaces the default arg redactor, which hides strings and bytes
+func WithAuditRedactor(redact func(arg interface{}) interface{}) AuditOption {
+	return func(w *AuditWrapper) {
+		w.redact = redact
+	}
+}
+
+// WithAuditLogger logs the sink errors to l
+func WithAuditLogger(l Logger) AuditOption {
+	return func(w *AuditWrapper) {
+		w.logger = l
+	}
+}
+
+// NewAuditWrapper new an audit wrapper writing to sink
+func NewAuditWrapper(sink AuditSink, options ...AuditOption) *AuditWrapper {
+	w := &AuditWrapper{
+		sink:   sink,
+		redact: redactAuditArg,
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext, the queries are not audited
+func (w *AuditWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return fn
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *AuditWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		now := time.Now()
+		res, err := fn(ctx, query, args...)
+		w.emit(ctx, now, query, args, res, err)
+		return res, err
+	}
+}
+
+func (w *AuditWrapper) emit(ctx context.Context, now time.Time, query string, args []interface{}, res sql.Result, err error) {
+	evt := AuditEvent{
+		Time:      now,
+		Statement: fingerprint(query),
+		TraceID:   traceID(ctx),
+	}
+	evt.Actor, _ = ctx.Value(actorKey{}).(string)
+	evt.RequestID, _ = ctx.Value(requestIDKey{}).(string)
+	for _, arg := range args {
+		evt.Args = append(evt.Args, w.redact(arg))
+	}
+	if err != nil {
+		evt.Error = err.Error()
+	} else if res != nil {
+		evt.RowsAffected, _ = res.RowsAffected()
+	}
+	if err := w.sink.Write(evt); err != nil && w.logger != nil {
+		w.logger.Log(os.Stderr, fmt.Sprintf("audit: %s\n", err))
+	}
+}
+
+// redactAuditArg keeps numbers, bools, times and nils, and hides the others
+func redactAuditArg(arg interface{}) interface{} {
+	switch arg.(type) {
+	case nil, bool, time.Time,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return arg
+	default:
+		return "[redacted]"
+	}
+}
+
+// traceID gets the trace ID of the span in ctx,
+// it works with the span contexts which have a TraceID method or field, such as jaeger and mocktracer
+func traceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	v := reflect.ValueOf(span.Context())
+	if m := v.MethodByName("TraceID"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return fmt.Sprint(m.Call(nil)[0].Interface())
+	}
+	if v = reflect.Indirect(v); v.Kind() == reflect.Struct {
+		if f := v.FieldByName("TraceID"); f.IsValid() && f.CanInterface() {
+			return fmt.Sprint(f.Interface())
+		}
+	}
+	return ""
+}
+
+// JSONLinesAuditSink writes the audit events as JSON lines
+type JSONLinesAuditSink struct {
+	w   io.Writer
+	enc *json.Encoder
+	sync.Mutex
+}
+
+// NewJSONLinesAuditSink new a JSON lines sink writing to w
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// OpenJSONLinesAuditFile opens or creates the file at path, and appends the audit events to it
+func OpenJSONLinesAuditFile(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesAuditSink(f), nil
+}
+
+// Write impls AuditSink
+func (s *JSONLinesAuditSink) Write(evt AuditEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.enc.Encode(evt)
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (s *JSONLinesAuditSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// AsyncAuditSink buffers the audit events and writes them to its sink in background.
+// Write never blocks, the events are dropped when the buffer is full.
+type AsyncAuditSink struct {
+	sink    AuditSink
+	events  chan AuditEvent
+	onError func(error)
+	dropped uint64
+	done    chan struct{}
+	closed  sync.Once
+	sync.RWMutex
+	closing bool
+}
+
+// NewAsyncAuditSink new an async sink buffering size events for sink, the write errors are passed to onError if set
+func NewAsyncAuditSink(sink AuditSink, size int, onError func(error)) *AsyncAuditSink {
+	s := &AsyncAuditSink{
+		sink:    sink,
+		events:  make(chan AuditEvent, size),
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *AsyncAuditSink) run() {
+	defer close(s.done)
+	for evt := range s.events {
+		if err := s.sink.Write(evt); err != nil && s.onError != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// Write impls AuditSink
+func (s *AsyncAuditSink) Write(evt AuditEvent) error {
+	s.RLock()
+	defer s.RUnlock()
+	if !s.closing {
+		select {
+		case s.events <- evt:
+			return nil
+		default:
+		}
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	return ErrAuditBufferFull
+}
+
+// Dropped returns how many events are dropped
+func (s *AsyncAuditSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close writes the buffered events and closes the underlying sink if it is an io.Closer
+func (s *AsyncAuditSink) Close() error {
+	s.closed.Do(func() {
+		s.Lock()
+		s.closing = true
+		close(s.events)
+		s.Unlock()
+	})
+	<-s.done
+	if c, ok := s.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
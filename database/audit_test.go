@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestAuditWrapper_WrapExecContext(t *testing.T) {
+	var buf bytes.Buffer
+	wp := NewAuditWrapper(NewJSONLinesAuditSink(&buf))
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if len(args) == 0 {
+			return nil, errors.New("boom")
+		}
+		return sqlmock.NewResult(0, 3), nil
+	})
+
+	span := opentracing.GlobalTracer().StartSpan("x")
+	ctx := opentracing.ContextWithSpan(context.TODO(), span)
+	ctx = ContextWithRequestID(ContextWithActor(ctx, "alice"), "req-1")
+	wp.WrapExecContext(fn, "")(ctx, "UPDATE users SET name = ? WHERE id = ?", "bob", 7)
+	wp.WrapExecContext(fn, "")(context.TODO(), "DELETE FROM users")
+
+	dec := json.NewDecoder(&buf)
+	var evt AuditEvent
+	if err := dec.Decode(&evt); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if evt.Statement != "update users set name = ? where id = ?" {
+		t.Errorf("Statement = %q", evt.Statement)
+	}
+	if fmt.Sprint(evt.Args) != "[[redacted] 7]" {
+		t.Errorf("Args = %v, want [[redacted] 7]", evt.Args)
+	}
+	if evt.RowsAffected != 3 || evt.Actor != "alice" || evt.RequestID != "req-1" {
+		t.Errorf("event = %+v", evt)
+	}
+	if want := fmt.Sprint(span.Context().(mocktracer.MockSpanContext).TraceID); evt.TraceID != want {
+		t.Errorf("TraceID = %q, want %q", evt.TraceID, want)
+	}
+
+	evt = AuditEvent{}
+	if err := dec.Decode(&evt); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if evt.Error != "boom" || evt.TraceID != "" {
+		t.Errorf("failed event = %+v", evt)
+	}
+}
+
+type blockingAuditSink struct {
+	block  chan struct{}
+	events []AuditEvent
+}
+
+func (s *blockingAuditSink) Write(evt AuditEvent) error {
+	<-s.block
+	s.events = append(s.events, evt)
+	return nil
+}
+
+func TestAsyncAuditSink(t *testing.T) {
+	sink := &blockingAuditSink{block: make(chan struct{})}
+	async := NewAsyncAuditSink(sink, 1, nil)
+
+	// the first event is taken by the writer, the second one is buffered
+	written := 0
+	for i := 0; i < 4; i++ {
+		if err := async.Write(AuditEvent{Statement: fmt.Sprint(i)}); err == nil {
+			written++
+		}
+	}
+	if written < 1 || async.Dropped() != uint64(4-written) {
+		t.Errorf("written = %d, dropped = %d", written, async.Dropped())
+	}
+	close(sink.block)
+	if err := async.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if len(sink.events) != written {
+		t.Errorf("events = %d, want %d", len(sink.events), written)
+	}
+	if err := async.Write(AuditEvent{}); !errors.Is(err, ErrAuditBufferFull) {
+		t.Errorf("Write() after Close error = %v, want %v", err, ErrAuditBufferFull)
+	}
+}
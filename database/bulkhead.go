@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBulkheadName     = "default"
+	defaultBulkheadLimit    = 16
+	defaultBulkheadMaxQueue = 64
+	defaultBulkheadMaxWait  = time.Second
+)
+
+const (
+	bulkheadQueueFull   = "queue full"
+	bulkheadWaitTimeout = "wait timeout"
+)
+
+// BulkheadFullError is returned without calling the database when the bulkhead is saturated
+type BulkheadFullError struct {
+	Bulkhead string
+	Reason   string
+}
+
+func (e *BulkheadFullError) Error() string {
+	return fmt.Sprintf("database: bulkhead %q rejected the statement: %s", e.Bulkhead, e.Reason)
+}
+
+type bulkheadKey struct{}
+
+// ContextWithBulkhead puts the statements called with the returned context into the named bulkhead
+func ContextWithBulkhead(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, bulkheadKey{}, name)
+}
+
+// BulkheadWrapper defines a bulkhead wrapper
+// which bounds the in-flight statements per named bulkhead, so one kind of traffic can not exhaust the pool.
+// The bulkhead is chosen by ContextWithBulkhead, then by the fingerprint patterns, or it is the default one.
+type BulkheadWrapper struct {
+	limit    int
+	maxQueue int
+	maxWait  time.Duration
+	limits   map[string][2]int
+	patterns []bulkheadPattern
+	monitor  Monitor
+
+	bulkheads map[string]*bulkhead
+	sync.Mutex
+}
+
+type bulkheadPattern struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+type bulkhead struct {
+	name     string
+	slots    chan struct{}
+	maxQueue int64
+	queued   int64
+}
+
+// BulkheadOption defines the bulkhead wrapper's option
+type BulkheadOption func(*BulkheadWrapper)
+
+// WithBulkheadDefaultLimit sets the in-flight limit and the queue size of the bulkheads without their own
+func WithBulkheadDefaultLimit(limit, maxQueue int) BulkheadOption {
+	return func(w *BulkheadWrapper) {
+		w.limit, w.maxQueue = limit, maxQueue
+	}
+}
+
+// WithBulkheadLimit sets the in-flight limit and the queue size of the named bulkhead
+func WithBulkheadLimit(name string, limit, maxQueue int) BulkheadOption {
+	return func(w *BulkheadWrapper) {
+		w.limits[name] = [2]int{limit, maxQueue}
+	}
+}
+
+// WithBulkheadMaxWait sets how long a statement waits in the queue before it is rejected
+func WithBulkheadMaxWait(d time.Duration) BulkheadOption {
+	return func(w *BulkheadWrapper) {
+		w.maxWait = d
+	}
+}
+
+// WithBulkheadPattern puts the statements whose fingerprint matches pattern into the named bulkhead
+func WithBulkheadPattern(pattern *regexp.Regexp, name string) BulkheadOption {
+	return func(w *BulkheadWrapper) {
+		w.patterns = append(w.patterns, bulkheadPattern{pattern: pattern, name: name})
+	}
+}
+
+// WithBulkheadMonitor reports the queue depth and the rejections to m
+func WithBulkheadMonitor(m Monitor) BulkheadOption {
+	return func(w *BulkheadWrapper) {
+		w.monitor = m
+	}
+}
+
+// NewBulkheadWrapper new a bulkhead wrapper,
+// by default a bulkhead runs 16 statements at a time, queues 64 more and rejects after waiting 1s
+// The query rows are read into memory before they are returned, so a result is held whole instead of streamed,
+// and the returned rows only keep the column names, their ColumnTypes have no database types, lengths or nullability.
+// Don't route the large results through the wrapper, or bound them with LIMIT.
+func NewBulkheadWrapper(options ...BulkheadOption) *BulkheadWrapper {
+	w := &BulkheadWrapper{
+		limit:     defaultBulkheadLimit,
+		maxQueue:  defaultBulkheadMaxQueue,
+		maxWait:   defaultBulkheadMaxWait,
+		limits:    make(map[string][2]int),
+		bulkheads: make(map[string]*bulkhead),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+// The rows keep their pooled connection until they are closed, so they are read into memory before the slot is released,
+// and the returned rows are served from memory. Reading a slow report is bounded as well as running it.
+func (w *BulkheadWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		release, err := w.acquire(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		set, err := w.read(ctx, fn, release, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		return set.open(ctx)
+	}
+}
+
+// read runs the query and reads its rows into memory, the slot is released once they are read
+func (w *BulkheadWrapper) read(ctx context.Context, fn QueryContextFunc, release func(), query string, args ...interface{}) (*rowSet, error) {
+	defer release()
+	rows, err := fn(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return materializeRows(rows)
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *BulkheadWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		release, err := w.acquire(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return fn(ctx, query, args...)
+	}
+}
+
+func (w *BulkheadWrapper) name(ctx context.Context, query string) string {
+	if name, ok := ctx.Value(bulkheadKey{}).(string); ok {
+		return name
+	}
+	if len(w.patterns) > 0 {
+		fp := fingerprint(query)
+		for _, p := range w.patterns {
+			if p.pattern.MatchString(fp) {
+				return p.name
+			}
+		}
+	}
+	return defaultBulkheadName
+}
+
+func (w *BulkheadWrapper) bulkhead(name string) *bulkhead {
+	w.Lock()
+	defer w.Unlock()
+	b, ok := w.bulkheads[name]
+	if !ok {
+		limit, maxQueue := w.limit, w.maxQueue
+		if l, ok := w.limits[name]; ok {
+			limit, maxQueue = l[0], l[1]
+		}
+		if limit <= 0 {
+			limit = 1
+		}
+		b = &bulkhead{
+			name:     name,
+			slots:    make(chan struct{}, limit),
+			maxQueue: int64(maxQueue),
+		}
+		w.bulkheads[name] = b
+	}
+	return b
+}
+
+// acquire takes a slot of the statement's bulkhead, waiting in its queue if all slots are taken
+func (w *BulkheadWrapper) acquire(ctx context.Context, query string) (func(), error) {
+	b := w.bulkhead(w.name(ctx, query))
+	release := func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if atomic.AddInt64(&b.queued, 1) > b.maxQueue {
+		atomic.AddInt64(&b.queued, -1)
+		w.report(b.name, BulkheadReject)
+		return nil, &BulkheadFullError{Bulkhead: b.name, Reason: bulkheadQueueFull}
+	}
+	w.report(b.name, BulkheadEnqueue)
+	defer func() {
+		atomic.AddInt64(&b.queued, -1)
+		w.report(b.name, BulkheadDequeue)
+	}()
+
+	var timeout <-chan time.Time
+	if w.maxWait > 0 {
+		timer := time.NewTimer(w.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		w.report(b.name, BulkheadReject)
+		return nil, &BulkheadFullError{Bulkhead: b.name, Reason: bulkheadWaitTimeout}
+	}
+}
+
+func (w *BulkheadWrapper) report(name string, op BulkheadOperation) {
+	if w.monitor == nil {
+		return
+	}
+	if err := w.monitor.Bulkhead(name, op); err != nil && os.Getenv(DEBUG_ENV) != "" {
+		w.monitor.Log(os.Stderr, fmt.Sprintf("bulkhead: %s\n", err))
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBulkheadWrapper(t *testing.T) {
+	monitor := &DefaultPoolMonitor{}
+	wp := NewBulkheadWrapper(
+		WithBulkheadLimit("report", 1, 1),
+		WithBulkheadMaxWait(20*time.Millisecond),
+		WithBulkheadPattern(regexp.MustCompile(`from reports`), "report"),
+		WithBulkheadMonitor(monitor),
+	)
+	started, block := make(chan struct{}), make(chan struct{})
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if query == "DELETE FROM reports WHERE id = 1" {
+			close(started)
+			<-block
+		}
+		return sqlmock.NewResult(0, 1), nil
+	})
+	exec := wp.WrapExecContext(fn, "")
+	ctx := context.TODO()
+
+	done := make(chan error)
+	go func() {
+		_, err := exec(ctx, "DELETE FROM reports WHERE id = 1")
+		done <- err
+	}()
+	<-started
+
+	queued := make(chan error)
+	go func() {
+		_, err := exec(ctx, "DELETE FROM reports WHERE id = 2")
+		queued <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	var full *BulkheadFullError
+	_, err := exec(ContextWithBulkhead(ctx, "report"), "UPDATE orders SET a = 1")
+	if !errors.As(err, &full) || full.Reason != bulkheadQueueFull {
+		t.Errorf("exec() with full queue error = %v, want %s", err, bulkheadQueueFull)
+	}
+	if _, err := exec(ctx, "UPDATE orders SET a = 1"); err != nil {
+		t.Errorf("exec() in the default bulkhead error = %v", err)
+	}
+	if err := <-queued; !errors.As(err, &full) || full.Reason != bulkheadWaitTimeout {
+		t.Errorf("queued exec() error = %v, want %s", err, bulkheadWaitTimeout)
+	}
+
+	close(block)
+	if err := <-done; err != nil {
+		t.Errorf("exec() error = %v", err)
+	}
+
+	stats := monitor.bulkheads["report"]
+	if stats.queued != 0 || stats.rejected != 2 {
+		t.Errorf("monitor queued = %d, rejected = %d, want 0 and 2", stats.queued, stats.rejected)
+	}
+}
+
+func TestBulkheadWrapper_WrapQueryContext(t *testing.T) {
+	calls := 0
+	wp := NewBulkheadWrapper(WithBulkheadLimit("report", 1, 0))
+	query := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "")
+	ctx := ContextWithBulkhead(context.TODO(), "report")
+
+	// the rows are read before the slot is released, leaving them open does not hold it
+	rows, err := query(ctx, "SELECT id, name FROM reports")
+	if err != nil {
+		t.Fatalf("query() error = %v", err)
+	}
+	defer rows.Close()
+	names := queryNames(t, query, "SELECT id, name FROM reports")
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("names = %v, want [a b]", names)
+	}
+	if !rows.Next() {
+		t.Errorf("Next() of the open rows = false, want the first row")
+	}
+}
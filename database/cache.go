@@ -0,0 +1,268 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultCacheTTL  = time.Minute
+	defaultCacheSize = 1024
+)
+
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// CacheWrapper defines a query cache wrapper
+// which keeps the materialized rows of SELECT statements in process, bounded by TTL and LRU size.
+// The cached rows are dropped once an exec writes to any table they are read from.
+// The reads marked by ContextWithTransaction are never cached.
+// CacheWrapper is a prometheus.Collector of its hits and misses.
+type CacheWrapper struct {
+	ttl    time.Duration
+	size   int
+	tables map[string]bool
+
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+	requests   *prometheus.CounterVec
+	sync.Mutex
+}
+
+type cacheEntry struct {
+	key     string
+	set     *rowSet
+	tables  []string
+	expires time.Time
+}
+
+// CacheOption defines the cache wrapper's option
+type CacheOption func(*CacheWrapper)
+
+// WithCacheTTL sets how long the rows are cached
+func WithCacheTTL(d time.Duration) CacheOption {
+	return func(w *CacheWrapper) {
+		if d > 0 {
+			w.ttl = d
+		}
+	}
+}
+
+// WithCacheSize sets how many results are cached, the least recently used ones are evicted first
+func WithCacheSize(n int) CacheOption {
+	return func(w *CacheWrapper) {
+		if n > 0 {
+			w.size = n
+		}
+	}
+}
+
+// WithCacheTables only caches the queries which read from the given tables,
+// by default all SELECT statements are cached
+func WithCacheTables(tables ...string) CacheOption {
+	return func(w *CacheWrapper) {
+		w.tables = make(map[string]bool, len(tables))
+		for _, t := range tables {
+			w.tables[strings.ToLower(t)] = true
+		}
+	}
+}
+
+// NewCacheWrapper new a query cache wrapper, by default it caches 1024 results for a minute
+func NewCacheWrapper(options ...CacheOption) *CacheWrapper {
+	w := &CacheWrapper{
+		ttl:     defaultCacheTTL,
+		size:    defaultCacheSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "db_query_cache",
+			Name:      "requests_total",
+			Help:      "query cache requests by result",
+		}, []string{"result"}),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// Describe impls prometheus.Collector
+func (w *CacheWrapper) Describe(ch chan<- *prometheus.Desc) {
+	w.requests.Describe(ch)
+}
+
+// Collect impls prometheus.Collector
+func (w *CacheWrapper) Collect(ch chan<- prometheus.Metric) {
+	w.requests.Collect(ch)
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *CacheWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		tables := statementTables(query)
+		// a read in a transaction may see its uncommitted writes, which must not be shared
+		if isTransaction(ctx) || !w.cacheable(query, tables) {
+			rows, err := fn(ctx, query, args...)
+			if !readVerbs[statementVerb(query)] {
+				w.invalidate(tables)
+			}
+			return rows, err
+		}
+
+		key, ok := cacheKey(query, args)
+		if !ok {
+			return fn(ctx, query, args...)
+		}
+		set, generation, ok := w.get(key)
+		w.record(ctx, ok)
+		if ok {
+			return set.open(ctx)
+		}
+		rows, err := fn(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		set, err = materializeRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		w.put(key, set, tables, generation)
+		return set.open(ctx)
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+// The cached rows read from the tables the exec writes to are dropped,
+// all of them are dropped if the tables are unknown.
+func (w *CacheWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		res, err := fn(ctx, query, args...)
+		w.invalidate(statementTables(query))
+		return res, err
+	}
+}
+
+// Len returns how many results are cached
+func (w *CacheWrapper) Len() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.lru.Len()
+}
+
+func (w *CacheWrapper) cacheable(query string, tables []string) bool {
+	if statementVerb(query) != "SELECT" || len(tables) == 0 || isLockingRead(query) {
+		return false
+	}
+	if w.tables == nil {
+		return true
+	}
+	for _, t := range tables {
+		if !w.tables[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *CacheWrapper) record(ctx context.Context, hit bool) {
+	result := cacheMiss
+	if hit {
+		result = cacheHit
+	}
+	w.requests.WithLabelValues(result).Inc()
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag("db.cache", result)
+	}
+}
+
+// get returns the cached rows of key, and the generation to put the rows with on a miss
+func (w *CacheWrapper) get(key string) (*rowSet, uint64, bool) {
+	w.Lock()
+	defer w.Unlock()
+	el, ok := w.entries[key]
+	if !ok {
+		return nil, w.generation, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		w.remove(el)
+		return nil, w.generation, false
+	}
+	w.lru.MoveToFront(el)
+	return entry.set, w.generation, true
+}
+
+// put caches the rows unless an invalidation happened after they were queried at generation
+func (w *CacheWrapper) put(key string, set *rowSet, tables []string, generation uint64) {
+	w.Lock()
+	defer w.Unlock()
+	if generation != w.generation {
+		return
+	}
+	if el, ok := w.entries[key]; ok {
+		w.remove(el)
+	}
+	w.entries[key] = w.lru.PushFront(&cacheEntry{
+		key:     key,
+		set:     set,
+		tables:  tables,
+		expires: time.Now().Add(w.ttl),
+	})
+	for w.lru.Len() > w.size {
+		w.remove(w.lru.Back())
+	}
+}
+
+func (w *CacheWrapper) invalidate(tables []string) {
+	w.Lock()
+	defer w.Unlock()
+	w.generation++
+	written := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		written[t] = true
+	}
+	for el := w.lru.Front(); el != nil; {
+		next := el.Next()
+		for _, t := range el.Value.(*cacheEntry).tables {
+			if len(written) == 0 || written[t] {
+				w.remove(el)
+				break
+			}
+		}
+		el = next
+	}
+}
+
+func (w *CacheWrapper) remove(el *list.Element) {
+	w.lru.Remove(el)
+	delete(w.entries, el.Value.(*cacheEntry).key)
+}
+
+// cacheKey keys the statement by its text and the typed values of its args as the driver sees them,
+// so that a pointer arg is keyed by the value it points to. False if an arg can not be converted.
+func cacheKey(query string, args []interface{}) (string, bool) {
+	var b strings.Builder
+	b.WriteString(query)
+	for _, arg := range args {
+		v, err := newFixtureValue(arg)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(0)
+		b.WriteString(v.Type)
+		b.WriteByte(':')
+		b.Write(v.Value)
+	}
+	return b.String(), true
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newCountingQueryFunc(t *testing.T, calls *int) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		*calls++
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name"}).AddRow(1, []byte("a")).AddRow(2, []byte("b")),
+		)
+		return db.QueryContext(ctx, query, args...)
+	}
+}
+
+func queryNames(t *testing.T, fn QueryContextFunc, query string, args ...interface{}) []string {
+	rows, err := fn(context.TODO(), query, args...)
+	if err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestCacheWrapper(t *testing.T) {
+	calls := 0
+	wp := NewCacheWrapper()
+	query := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "SELECT id, name FROM countries WHERE id > ?", 0)
+	exec := wp.WrapExecContext(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		return sqlmock.NewResult(0, 1), nil
+	}, "")
+	ctx := context.TODO()
+
+	for i := 0; i < 2; i++ {
+		names := queryNames(t, query, "SELECT id, name FROM countries WHERE id > ?", 0)
+		if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+			t.Errorf("names = %v, want [a b]", names)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	queryNames(t, query, "SELECT id, name FROM countries WHERE id > ?", 1)
+	if calls != 2 {
+		t.Errorf("calls with other args = %d, want 2", calls)
+	}
+
+	exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "x", 1)
+	if wp.Len() != 2 {
+		t.Errorf("Len() after writing another table = %d, want 2", wp.Len())
+	}
+	exec(ctx, "UPDATE countries SET name = ? WHERE id = ?", "x", 1)
+	if wp.Len() != 0 {
+		t.Errorf("Len() after writing the cached table = %d, want 0", wp.Len())
+	}
+
+	if hits := testutil.ToFloat64(wp.requests.WithLabelValues(cacheHit)); hits != 1 {
+		t.Errorf("hits = %v, want 1", hits)
+	}
+	if misses := testutil.ToFloat64(wp.requests.WithLabelValues(cacheMiss)); misses != 2 {
+		t.Errorf("misses = %v, want 2", misses)
+	}
+}
+
+func TestCacheWrapper_Bounds(t *testing.T) {
+	calls := 0
+	wp := NewCacheWrapper(WithCacheSize(2), WithCacheTTL(10*time.Millisecond), WithCacheTables("countries"))
+	query := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "")
+
+	for i := 0; i < 3; i++ {
+		queryNames(t, query, "SELECT id, name FROM countries WHERE id > ?", i)
+	}
+	if wp.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", wp.Len())
+	}
+	queryNames(t, query, "SELECT id, name FROM users WHERE id > ?", 0)
+	if wp.Len() != 2 {
+		t.Errorf("Len() after an uncached table = %d, want 2", wp.Len())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	queryNames(t, query, "SELECT id, name FROM countries WHERE id > ?", 2)
+	if calls != 5 {
+		t.Errorf("calls = %d, want 5", calls)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	id := 1
+	key1, ok := cacheKey("SELECT a FROM t WHERE id = ?", []interface{}{&id})
+	if !ok {
+		t.Fatalf("cacheKey() of a pointer arg is not ok")
+	}
+	id = 2
+	key2, _ := cacheKey("SELECT a FROM t WHERE id = ?", []interface{}{&id})
+	if key1 == key2 {
+		t.Errorf("cacheKey() of a reused pointer = %q, want keyed by its value", key2)
+	}
+	if key, _ := cacheKey("SELECT a FROM t WHERE id = ?", []interface{}{int64(2)}); key != key2 {
+		t.Errorf("cacheKey() = %q, want %q", key, key2)
+	}
+	if key, _ := cacheKey("SELECT a FROM t WHERE id = ?", []interface{}{"2"}); key == key2 {
+		t.Errorf("cacheKey() of a string = %q, want typed", key)
+	}
+
+	if _, ok := cacheKey("SELECT a FROM t WHERE id IN (?)", []interface{}{[]int{1, 2}}); ok {
+		t.Errorf("cacheKey() of an unconvertible arg is ok, want not cached")
+	}
+}
+
+func TestCacheWrapper_Transaction(t *testing.T) {
+	calls := 0
+	wp := NewCacheWrapper()
+	query := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "")
+	ctx := ContextWithTransaction(context.TODO())
+
+	for i := 0; i < 2; i++ {
+		rows, err := query(ctx, "SELECT id, name FROM countries")
+		if err != nil {
+			t.Fatalf("query() error = %v", err)
+		}
+		rows.Close()
+	}
+	if calls != 2 || wp.Len() != 0 {
+		t.Errorf("calls = %d, Len() = %d, want 2 and nothing cached", calls, wp.Len())
+	}
+}
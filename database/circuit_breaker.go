@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitErrorRate      = 0.5
+	defaultCircuitMinRequests    = 20
+	defaultCircuitWindow         = 10 * time.Second
+	defaultCircuitOpenTimeout    = 5 * time.Second
+	defaultCircuitHalfOpenProbes = 1
+)
+
+// CircuitState defines the state of a circuit breaker
+type CircuitState uint8
+
+const (
+	CircuitClosed CircuitState = iota + 1
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitOpenError is returned without calling the database while the circuit of the instance is open
+type CircuitOpenError struct {
+	Instance string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("database: circuit breaker of instance %q is open", e.Instance)
+}
+
+type instanceKey struct{}
+
+// ContextWithInstance sets the database instance the statements called with the returned context go to
+func ContextWithInstance(ctx context.Context, instance string) context.Context {
+	return context.WithValue(ctx, instanceKey{}, instance)
+}
+
+func instanceFromContext(ctx context.Context) (string, bool) {
+	instance, ok := ctx.Value(instanceKey{}).(string)
+	return instance, ok
+}
+
+// CircuitBreakerWrapper defines a circuit breaker wrapper
+// which keeps one circuit per database instance and fails fast while the circuit is open
+type CircuitBreakerWrapper struct {
+	instance       string
+	errorRate      float64
+	minRequests    int
+	window         time.Duration
+	openTimeout    time.Duration
+	halfOpenProbes int
+	logger         Logger
+
+	breakers map[string]*circuitBreaker
+	sync.Mutex
+}
+
+// CircuitBreakerOption defines the circuit breaker wrapper's option
+type CircuitBreakerOption func(*CircuitBreakerWrapper)
+
+// WithCircuitErrorRate opens the circuit once minRequests are made in a window
+// and the ratio of failed ones reaches rate
+func WithCircuitErrorRate(rate float64, minRequests int) CircuitBreakerOption {
+	return func(w *CircuitBreakerWrapper) {
+		if rate > 0 && rate <= 1 {
+			w.errorRate = rate
+		}
+		if minRequests > 0 {
+			w.minRequests = minRequests
+		}
+	}
+}
+
+// WithCircuitWindow sets the window in which the error rate is counted
+func WithCircuitWindow(d time.Duration) CircuitBreakerOption {
+	return func(w *CircuitBreakerWrapper) {
+		if d > 0 {
+			w.window = d
+		}
+	}
+}
+
+// WithCircuitOpenTimeout sets how long the circuit stays open before it half-opens to probe
+func WithCircuitOpenTimeout(d time.Duration) CircuitBreakerOption {
+	return func(w *CircuitBreakerWrapper) {
+		if d > 0 {
+			w.openTimeout = d
+		}
+	}
+}
+
+// WithCircuitHalfOpenProbes sets how many statements may probe the instance at the same time while half-open
+func WithCircuitHalfOpenProbes(n int) CircuitBreakerOption {
+	return func(w *CircuitBreakerWrapper) {
+		if n > 0 {
+			w.halfOpenProbes = n
+		}
+	}
+}
+
+// WithCircuitLogger reports the state transitions to l, a Monitor can be used as well
+func WithCircuitLogger(l Logger) CircuitBreakerOption {
+	return func(w *CircuitBreakerWrapper) {
+		w.logger = l
+	}
+}
+
+// NewCircuitBreakerWrapper new a circuit breaker wrapper.
+// The statements are accounted to the instance set by ContextWithInstance, or to the given default instance.
+func NewCircuitBreakerWrapper(instance string, options ...CircuitBreakerOption) *CircuitBreakerWrapper {
+	w := &CircuitBreakerWrapper{
+		instance:       instance,
+		errorRate:      defaultCircuitErrorRate,
+		minRequests:    defaultCircuitMinRequests,
+		window:         defaultCircuitWindow,
+		openTimeout:    defaultCircuitOpenTimeout,
+		halfOpenProbes: defaultCircuitHalfOpenProbes,
+		breakers:       make(map[string]*circuitBreaker),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *CircuitBreakerWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		b, token, err := w.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := fn(ctx, query, args...)
+		w.release(b, token, err)
+		return rows, err
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *CircuitBreakerWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		b, token, err := w.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res, err := fn(ctx, query, args...)
+		w.release(b, token, err)
+		return res, err
+	}
+}
+
+// State returns the current state of the instance's circuit
+func (w *CircuitBreakerWrapper) State(instance string) CircuitState {
+	b := w.breaker(instance)
+	b.Lock()
+	defer b.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= w.openTimeout {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+func (w *CircuitBreakerWrapper) breaker(instance string) *circuitBreaker {
+	w.Lock()
+	defer w.Unlock()
+	b, ok := w.breakers[instance]
+	if !ok {
+		b = &circuitBreaker{
+			instance:    instance,
+			state:       CircuitClosed,
+			windowStart: time.Now(),
+		}
+		w.breakers[instance] = b
+	}
+	return b
+}
+
+func (w *CircuitBreakerWrapper) acquire(ctx context.Context) (*circuitBreaker, circuitToken, error) {
+	instance, ok := instanceFromContext(ctx)
+	if !ok {
+		instance = w.instance
+	}
+	b := w.breaker(instance)
+	token, allowed, from, to := b.allow(w, time.Now())
+	w.report(instance, from, to)
+	if !allowed {
+		return nil, token, &CircuitOpenError{Instance: instance}
+	}
+	return b, token, nil
+}
+
+func (w *CircuitBreakerWrapper) release(b *circuitBreaker, token circuitToken, err error) {
+	from, to := b.done(w, token, time.Now(), isCircuitFailure(err))
+	w.report(b.instance, from, to)
+}
+
+func (w *CircuitBreakerWrapper) report(instance string, from, to CircuitState) {
+	if from == to || w.logger == nil {
+		return
+	}
+	w.logger.Log(os.Stderr, fmt.Sprintf("circuit breaker: instance %q %s -> %s\n", instance, from, to))
+}
+
+// isCircuitFailure reports whether err means the instance is unhealthy,
+// errors like syntax errors or duplicate keys are the caller's fault and do not count
+func isCircuitFailure(err error) bool {
+	return isConnError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+type circuitBreaker struct {
+	instance    string
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	// generation is increased on every state transition
+	generation uint64
+	sync.Mutex
+}
+
+// circuitToken is the admission of a statement, only its outcome in the same generation counts
+type circuitToken struct {
+	generation uint64
+	probe      bool
+}
+
+// allow reports whether a statement may go to the instance, and the state transition it caused
+func (b *circuitBreaker) allow(w *CircuitBreakerWrapper, now time.Time) (circuitToken, bool, CircuitState, CircuitState) {
+	b.Lock()
+	defer b.Unlock()
+	from := b.state
+	if b.state == CircuitOpen {
+		if now.Sub(b.openedAt) < w.openTimeout {
+			return circuitToken{}, false, from, b.state
+		}
+		b.transit(CircuitHalfOpen)
+		b.probes = 0
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probes >= w.halfOpenProbes {
+			return circuitToken{}, false, from, b.state
+		}
+		b.probes++
+		return circuitToken{generation: b.generation, probe: true}, true, from, b.state
+	}
+	return circuitToken{generation: b.generation}, true, from, b.state
+}
+
+// done records the outcome of a statement, and returns the state transition it caused.
+// The outcomes of the statements admitted in another generation are stale and ignored,
+// such as a slow one admitted before the circuit opened, which must not decide the half-open probe.
+func (b *circuitBreaker) done(w *CircuitBreakerWrapper, token circuitToken, now time.Time, failed bool) (CircuitState, CircuitState) {
+	b.Lock()
+	defer b.Unlock()
+	from := b.state
+	if token.generation != b.generation {
+		return from, b.state
+	}
+	switch b.state {
+	case CircuitClosed:
+		if now.Sub(b.windowStart) > w.window {
+			b.reset(now)
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= w.minRequests && float64(b.failures)/float64(b.requests) >= w.errorRate {
+			b.transit(CircuitOpen)
+			b.openedAt = now
+		}
+	case CircuitHalfOpen:
+		if !token.probe {
+			break
+		}
+		b.probes--
+		if failed {
+			b.transit(CircuitOpen)
+			b.openedAt = now
+		} else {
+			b.transit(CircuitClosed)
+			b.reset(now)
+		}
+	}
+	return from, b.state
+}
+
+// transit moves the circuit to state in a new generation
+func (b *circuitBreaker) transit(state CircuitState) {
+	b.state = state
+	b.generation++
+}
+
+func (b *circuitBreaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type transitionLogger struct {
+	logs []string
+}
+
+func (l *transitionLogger) Log(_ io.Writer, a any) {
+	l.logs = append(l.logs, fmt.Sprint(a))
+}
+
+func TestCircuitBreakerWrapper(t *testing.T) {
+	logger := &transitionLogger{}
+	wp := NewCircuitBreakerWrapper("master",
+		WithCircuitErrorRate(0.5, 4),
+		WithCircuitOpenTimeout(10*time.Millisecond),
+		WithCircuitLogger(logger),
+	)
+	var fail bool
+	calls := 0
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		calls++
+		if fail {
+			return nil, driver.ErrBadConn
+		}
+		return sqlmock.NewResult(0, 1), nil
+	})
+	exec := wp.WrapExecContext(fn, "UPDATE a SET b = 1")
+	ctx := context.TODO()
+
+	fail = true
+	for i := 0; i < 4; i++ {
+		exec(ctx, "UPDATE a SET b = 1")
+	}
+	if s := wp.State("master"); s != CircuitOpen {
+		t.Fatalf("State() = %v, want %v", s, CircuitOpen)
+	}
+
+	_, err := exec(ctx, "UPDATE a SET b = 1")
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.Instance != "master" {
+		t.Errorf("exec() error = %v, want CircuitOpenError of master", err)
+	}
+	if calls != 4 {
+		t.Errorf("calls = %d, want 4", calls)
+	}
+
+	if _, err := exec(ContextWithInstance(ctx, "slave"), "UPDATE a SET b = 1"); errors.As(err, &openErr) {
+		t.Errorf("exec() on another instance error = %v, want not open", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	fail = false
+	if _, err := exec(ctx, "UPDATE a SET b = 1"); err != nil {
+		t.Errorf("exec() while half-open error = %v", err)
+	}
+	if s := wp.State("master"); s != CircuitClosed {
+		t.Errorf("State() = %v, want %v", s, CircuitClosed)
+	}
+
+	want := []string{
+		"circuit breaker: instance \"master\" closed -> open\n",
+		"circuit breaker: instance \"master\" open -> half-open\n",
+		"circuit breaker: instance \"master\" half-open -> closed\n",
+	}
+	if fmt.Sprint(logger.logs) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", logger.logs, want)
+	}
+}
+
+func TestCircuitBreaker_staleOutcome(t *testing.T) {
+	wp := NewCircuitBreakerWrapper("master", WithCircuitErrorRate(0.5, 1), WithCircuitOpenTimeout(time.Millisecond))
+	b := wp.breaker("master")
+	now := time.Now()
+
+	stale, _, _, _ := b.allow(wp, now)
+	failed, _, _, _ := b.allow(wp, now)
+	if _, to := b.done(wp, failed, now, true); to != CircuitOpen {
+		t.Fatalf("done() = %v, want %v", to, CircuitOpen)
+	}
+	probe, ok, _, to := b.allow(wp, now.Add(time.Second))
+	if !ok || to != CircuitHalfOpen || !probe.probe {
+		t.Fatalf("allow() = %+v, %v, %v, want a half-open probe", probe, ok, to)
+	}
+
+	// the statement admitted while closed finishes before the probe
+	if _, to := b.done(wp, stale, now.Add(time.Second), false); to != CircuitHalfOpen {
+		t.Errorf("done() of a stale statement = %v, want %v", to, CircuitHalfOpen)
+	}
+	if _, ok, _, _ := b.allow(wp, now.Add(time.Second)); ok {
+		t.Errorf("allow() = true, want the probe slot still taken")
+	}
+	if _, to := b.done(wp, probe, now.Add(time.Second), false); to != CircuitClosed {
+		t.Errorf("done() of the probe = %v, want %v", to, CircuitClosed)
+	}
+	if _, to := b.done(wp, failed, now.Add(time.Second), true); to != CircuitClosed {
+		t.Errorf("done() of a stale failure = %v, want %v", to, CircuitClosed)
+	}
+}
+
+func TestIsCircuitFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"TestIsCircuitFailure_Nil", nil, false},
+		{"TestIsCircuitFailure_BadConn", driver.ErrBadConn, true},
+		{"TestIsCircuitFailure_DeadlineExceeded", context.DeadlineExceeded, true},
+		{"TestIsCircuitFailure_Canceled", context.Canceled, false},
+		{"TestIsCircuitFailure_Duplicate", &mysqlError{Number: 1062}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCircuitFailure(tt.err); got != tt.want {
+				t.Errorf("isCircuitFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
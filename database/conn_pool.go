@@ -1,15 +1,23 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ezbuy/statsd"
 	"github.com/ezbuy/wrapper/pkg/net"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/push"
 )
 
@@ -22,6 +30,8 @@ type MonitorType uint8
 const (
 	StatsD MonitorType = iota + 1
 	Prometheus
+	// PrometheusPull is the prometheus monitor scraped by the prometheus server instead of pushing to a gateway
+	PrometheusPull
 )
 
 type ConnOperation uint8
@@ -31,6 +41,8 @@ const (
 	ConnClose
 	Connoccupy
 	ConnRelease
+	// ConnReady is reported when a created connection finishes the handshake and is ready to use
+	ConnReady
 )
 
 type PoolOperation uint8
@@ -38,6 +50,39 @@ type PoolOperation uint8
 const (
 	PoolCreate PoolOperation = iota + 1
 	PoolClear
+	PoolClose
+)
+
+// CheckoutOperation is a connection checkout attempt, or the reason it failed
+type CheckoutOperation uint8
+
+const (
+	CheckoutStart CheckoutOperation = iota + 1
+	CheckoutTimeout
+	CheckoutPoolClosed
+	CheckoutConnError
+)
+
+// reason returns the failure reason of op used by the stats and the metrics, "" if op is not a failure
+func (op CheckoutOperation) reason() string {
+	switch op {
+	case CheckoutTimeout:
+		return "timeout"
+	case CheckoutPoolClosed:
+		return "pool_closed"
+	case CheckoutConnError:
+		return "conn_error"
+	default:
+		return ""
+	}
+}
+
+type BulkheadOperation uint8
+
+const (
+	BulkheadEnqueue BulkheadOperation = iota + 1
+	BulkheadDequeue
+	BulkheadReject
 )
 
 type Logger interface {
@@ -48,10 +93,100 @@ type Monitor interface {
 	Logger
 	Pool(PoolOperation) error
 	Conn(ConnOperation) error
+	Checkout(CheckoutOperation) error
+	Bulkhead(string, BulkheadOperation) error
+}
+
+// CheckoutWaitMonitor is a Monitor of how long the checkouts wait for a connection as well.
+// NewMongoDriverMonitor reports the waits if the monitor implements it.
+type CheckoutWaitMonitor interface {
+	Monitor
+	// CheckoutWait reports how long a checkout from the pool of the server address waited, whether it succeeded or not
+	CheckoutWait(address string, d time.Duration) error
+}
+
+// AddressMonitor is a Monitor tracking the pool, connection and occupancy state per server address,
+// such as the mongos or the replica set members.
+// NewMongoDriverMonitor reports the pool events with their address if the monitor implements it.
+type AddressMonitor interface {
+	Monitor
+	PoolAt(address string, op PoolOperation) error
+	ConnAt(address string, op ConnOperation) error
+	CheckoutAt(address string, op CheckoutOperation) error
+	// RemoveAddress drops the state of the server address, when its pool is closed as it left the topology
+	RemoveAddress(address string) error
+}
+
+// ServerOperation is a change of a server or of the topology
+type ServerOperation uint8
+
+const (
+	ServerOpen ServerOperation = iota + 1
+	ServerClose
+	// ServerDescriptionChange is reported when the server's description changes, such as from secondary to primary
+	ServerDescriptionChange
+	// PrimaryChange is reported on the new primary address when the topology elects a primary, "" if it has none
+	PrimaryChange
+)
+
+// name returns the name of op used by the stats and the metrics
+func (op ServerOperation) name() string {
+	switch op {
+	case ServerOpen:
+		return "open"
+	case ServerClose:
+		return "close"
+	case ServerDescriptionChange:
+		return "description_changed"
+	case PrimaryChange:
+		return "primary_changed"
+	default:
+		return ""
+	}
+}
+
+// TopologyMonitor is a Monitor of the servers and the topology as well, so that the failovers are visible.
+// NewMongoServerMonitor reports the heartbeats and the changes if the monitor implements it.
+type TopologyMonitor interface {
+	Monitor
+	// Heartbeat reports a heartbeat to the server address, which failed if err is not nil
+	Heartbeat(address string, d time.Duration, err error) error
+	Server(address string, op ServerOperation) error
+}
+
+var (
+	_ CheckoutWaitMonitor = (*StatsDPoolMonitor)(nil)
+	_ CheckoutWaitMonitor = (*PrometheusPoolMonitor)(nil)
+	_ CheckoutWaitMonitor = (*PrometheusPullPoolMonitor)(nil)
+	_ CheckoutWaitMonitor = (*DefaultPoolMonitor)(nil)
+)
+
+var (
+	_ TopologyMonitor = (*StatsDPoolMonitor)(nil)
+	_ TopologyMonitor = (*PrometheusPoolMonitor)(nil)
+	_ TopologyMonitor = (*PrometheusPullPoolMonitor)(nil)
+	_ TopologyMonitor = (*DefaultPoolMonitor)(nil)
+)
+
+var (
+	_ AddressMonitor = (*StatsDPoolMonitor)(nil)
+	_ AddressMonitor = (*PrometheusPoolMonitor)(nil)
+	_ AddressMonitor = (*PrometheusPullPoolMonitor)(nil)
+	_ AddressMonitor = (*DefaultPoolMonitor)(nil)
+)
+
+// addressStats is the pool, connection and occupancy state of a server address
+type addressStats struct {
+	pools    int64
+	conns    int64
+	occupied int64
 }
 
 type StatsDPoolMonitor struct {
-	prefix string
+	prefix    string
+	addresses map[string]*addressStats
+	dbStats   dbStatsTracker
+	sync.Mutex
 }
 
 func NewStatsDPoolMonitor(appName string) *StatsDPoolMonitor {
@@ -65,175 +200,993 @@ func (m *StatsDPoolMonitor) Log(w io.Writer, args any) {
 }
 
 func (c *StatsDPoolMonitor) Pool(op PoolOperation) error {
+	return c.PoolAt("", op)
+}
+
+func (c *StatsDPoolMonitor) PoolAt(address string, op PoolOperation) error {
 	switch op {
 	case PoolCreate:
-		statsd.Incr(c.prefix + ".db.pool")
+		c.incr(address, ".pool", 1)
 	case PoolClear:
-		statsd.IncrByVal(c.prefix+".db.pool", -1)
+		c.incr(address, ".pool", -1)
+	case PoolClose:
+		statsd.Incr(c.prefix + ".db.pool.closed")
 	}
 	return nil
 }
 
 func (c *StatsDPoolMonitor) Conn(op ConnOperation) error {
+	return c.ConnAt("", op)
+}
+
+func (c *StatsDPoolMonitor) ConnAt(address string, op ConnOperation) error {
 	switch op {
 	case ConnCreate:
-		statsd.Incr(c.prefix + ".db.conn")
+		c.incr(address, ".conn", 1)
 	case ConnClose:
-		statsd.IncrByVal(c.prefix+".db.conn", -1)
+		c.incr(address, ".conn", -1)
 	case Connoccupy:
-		statsd.Incr(c.prefix + ".db.conn.occupy")
+		c.incr(address, ".conn.occupy", 1)
 	case ConnRelease:
-		statsd.IncrByVal(c.prefix+".db.conn.occupy", -1)
+		c.incr(address, ".conn.occupy", -1)
+	case ConnReady:
+		statsd.Incr(c.prefix + ".db.conn.ready")
+	}
+	return nil
+}
+
+func (c *StatsDPoolMonitor) Checkout(op CheckoutOperation) error {
+	return c.CheckoutAt("", op)
+}
+
+func (c *StatsDPoolMonitor) CheckoutAt(address string, op CheckoutOperation) error {
+	if op == CheckoutStart {
+		statsd.Incr(c.prefix + ".db.checkout")
+		return nil
+	}
+	if reason := op.reason(); reason != "" {
+		statsd.Incr(c.prefix + ".db.checkout.failed." + reason)
+	}
+	return nil
+}
+
+// RemoveAddress reverts the stats the address still holds, so that they are not left behind
+func (c *StatsDPoolMonitor) RemoveAddress(address string) error {
+	c.Lock()
+	s, ok := c.addresses[address]
+	delete(c.addresses, address)
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+	for stat, n := range map[string]int64{".pool": s.pools, ".conn": s.conns, ".conn.occupy": s.occupied} {
+		if n != 0 {
+			statsd.IncrByVal(c.prefix+".db"+stat, -n)
+			statsd.IncrByVal(c.prefix+".db.address."+statsDAddress(address)+stat, -n)
+		}
+	}
+	return nil
+}
+
+// incr updates the stat of the pools, and the one of the address if it is known
+func (c *StatsDPoolMonitor) incr(address string, stat string, delta int64) {
+	statsd.IncrByVal(c.prefix+".db"+stat, delta)
+	if address == "" {
+		return
+	}
+	statsd.IncrByVal(c.prefix+".db.address."+statsDAddress(address)+stat, delta)
+	c.Lock()
+	defer c.Unlock()
+	if c.addresses == nil {
+		c.addresses = make(map[string]*addressStats)
+	}
+	s, ok := c.addresses[address]
+	if !ok {
+		s = &addressStats{}
+		c.addresses[address] = s
+	}
+	s.add(stat, delta)
+}
+
+func (s *addressStats) add(stat string, delta int64) {
+	switch stat {
+	case ".pool":
+		s.pools += delta
+	case ".conn":
+		s.conns += delta
+	case ".conn.occupy":
+		s.occupied += delta
+	}
+}
+
+// CheckoutWait times the waits, see newMonitorCheckoutWait for their accuracy
+func (c *StatsDPoolMonitor) CheckoutWait(address string, d time.Duration) error {
+	statsd.TimingByValue(c.prefix+".db.checkout.wait", d)
+	statsd.TimingByValue(c.prefix+".db.checkout.wait."+statsDAddress(address), d)
+	return nil
+}
+
+func (c *StatsDPoolMonitor) Heartbeat(address string, d time.Duration, err error) error {
+	if err != nil {
+		statsd.Incr(c.prefix + ".db.heartbeat.failed")
+		statsd.Incr(c.prefix + ".db.heartbeat.failed." + statsDAddress(address))
+		return nil
+	}
+	statsd.TimingByValue(c.prefix+".db.heartbeat", d)
+	statsd.TimingByValue(c.prefix+".db.heartbeat."+statsDAddress(address), d)
+	return nil
+}
+
+func (c *StatsDPoolMonitor) Server(address string, op ServerOperation) error {
+	if name := op.name(); name != "" {
+		statsd.Incr(c.prefix + ".db.server." + name)
+	}
+	return nil
+}
+
+func (c *StatsDPoolMonitor) DBStats(name string, stats sql.DBStats) error {
+	stat := c.prefix + ".db.sql." + name
+	statsd.Gauge(stat+".open", int64(stats.OpenConnections))
+	statsd.Gauge(stat+".in_use", int64(stats.InUse))
+	statsd.Gauge(stat+".idle", int64(stats.Idle))
+	statsd.Gauge(stat+".max_open", int64(stats.MaxOpenConnections))
+	delta := c.dbStats.delta(name, stats)
+	statsd.IncrByVal(stat+".wait", delta.WaitCount)
+	statsd.IncrByVal(stat+".wait_ms", delta.WaitDuration.Milliseconds())
+	statsd.IncrByVal(stat+".closed.max_idle", delta.MaxIdleClosed)
+	statsd.IncrByVal(stat+".closed.max_idle_time", delta.MaxIdleTimeClosed)
+	statsd.IncrByVal(stat+".closed.max_lifetime", delta.MaxLifetimeClosed)
+	return nil
+}
+
+func (c *StatsDPoolMonitor) removeDBStats(name string) {
+	c.dbStats.remove(name)
+}
+
+// statsDAddress replaces the dots and the colons of address, which are the separators of the StatsD stats
+func statsDAddress(address string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(address)
+}
+
+func (c *StatsDPoolMonitor) Bulkhead(name string, op BulkheadOperation) error {
+	switch op {
+	case BulkheadEnqueue:
+		statsd.Incr(c.prefix + ".db.bulkhead." + name + ".queue")
+	case BulkheadDequeue:
+		statsd.IncrByVal(c.prefix+".db.bulkhead."+name+".queue", -1)
+	case BulkheadReject:
+		statsd.Incr(c.prefix + ".db.bulkhead." + name + ".rejected")
 	}
 	return nil
 }
 
 // PrometheusMonitor is the prometheus based monitor
-// but must be used with prometheus pushgateway
+// but must be used with prometheus pushgateway.
+// The events only update the metrics, the changes are pushed in background every interval and on Close.
 type PrometheusPoolMonitor struct {
 	prefix     string
 	p          *push.Pusher
-	collectors map[monitorKind]prometheus.Collector
-	sync.Mutex
+	collectors *poolCollectors
+	interval   time.Duration
+	retries    int
+	backoff    time.Duration
+	onError    func(error)
+	// dirty is 1 when the metrics changed since the last successful push
+	dirty   int32
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	lastErr error
 }
 
 const (
-	subsystemScope = "monitor_mongo"
+	defaultSubsystem = "database"
 )
 
+// poolLabels are the labels of all the pool metrics, so that they can be aggregated across the apps and the databases.
+// The metric names are the same for all of them, the monitors sharing a registerer share the metrics.
+var poolLabels = []string{"app", "db_type", "cluster", "address"}
+
 type monitorKind uint8
 
 const (
 	monitorKindPool monitorKind = iota + 1
 	monitorKindConn
 	monitorKindConnOccupy
+	monitorKindBulkheadQueue
+	monitorKindBulkheadReject
+	monitorKindPoolClosed
+	monitorKindConnReady
+	monitorKindCheckout
+	monitorKindCheckoutFailed
+	monitorKindCheckoutWait
+	monitorKindHeartbeat
+	monitorKindHeartbeatFailed
+	monitorKindServer
+	monitorKindSQLConns
+	monitorKindSQLWait
+	monitorKindSQLWaitSeconds
+	monitorKindSQLClosed
 )
 
-func newMonitorPool(prefix string) prometheus.Gauge {
-	return prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: subsystemScope,
-		Name:      prefix + "_pool_current",
+func newMonitorPool(subsystem string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "pool_current",
 		Help:      "pool ",
-	})
+	}, poolLabels)
 }
 
-func newMonitorConn(prefix string) prometheus.Gauge {
-	return prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: subsystemScope,
-		Name:      prefix + "_conn_current",
+func newMonitorConn(subsystem string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "conn_current",
 		Help:      "conn",
-	})
+	}, poolLabels)
 }
 
-func newMonitorConnOccupy(prefix string) prometheus.Gauge {
-	return prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: subsystemScope,
-		Name:      prefix + "_conn_occupy_current",
+func newMonitorConnOccupy(subsystem string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "conn_occupy_current",
 		Help:      "conn occupy",
-	})
+	}, poolLabels)
+}
+
+func newMonitorBulkheadQueue(subsystem string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "bulkhead_queue_current",
+		Help:      "bulkhead queue",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "bulkhead"))
+}
+
+func newMonitorBulkheadReject(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "bulkhead_rejected_total",
+		Help:      "bulkhead rejected",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "bulkhead"))
+}
+
+func newMonitorPoolClosed(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "pool_closed_total",
+		Help:      "pool closed",
+	}, poolLabels)
+}
+
+func newMonitorConnReady(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "conn_ready_total",
+		Help:      "conn ready",
+	}, poolLabels)
+}
+
+func newMonitorCheckout(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "checkout_total",
+		Help:      "checkout attempts",
+	}, poolLabels)
+}
+
+func newMonitorCheckoutFailed(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "checkout_failed_total",
+		Help:      "checkout failures",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "reason"))
+}
+
+// newMonitorCheckoutWait observes the checkout waits reported by NewMongoDriverMonitor.
+// The driver's events do not identify the checkouts, a finished one is matched to the earliest started one of its address.
+// The waits of the overlapping checkouts are approximate: their sum and count are exact,
+// but a fast checkout finishing before a slow one takes the slow one's wait, which skews the buckets.
+func newMonitorCheckoutWait(subsystem string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: subsystem,
+		Name:      "checkout_wait_seconds",
+		Help:      "checkout wait, approximate for the overlapping checkouts of an address",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, poolLabels)
+}
+
+func newMonitorHeartbeat(subsystem string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: subsystem,
+		Name:      "heartbeat_seconds",
+		Help:      "heartbeat",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, poolLabels)
+}
+
+func newMonitorHeartbeatFailed(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "heartbeat_failed_total",
+		Help:      "heartbeat failures",
+	}, poolLabels)
+}
+
+func newMonitorServer(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "server_events_total",
+		Help:      "server and topology changes",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "event"))
+}
+
+func newMonitorSQLConns(subsystem string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "sql_connections",
+		Help:      "sql connections by state",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "name", "state"))
+}
+
+func newMonitorSQLWait(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "sql_wait_total",
+		Help:      "sql connections waited for",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "name"))
+}
+
+func newMonitorSQLWaitSeconds(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "sql_wait_seconds_total",
+		Help:      "sql connection wait",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "name"))
 }
 
+func newMonitorSQLClosed(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "sql_closed_total",
+		Help:      "sql connections closed by reason",
+	}, append(poolLabels[:len(poolLabels):len(poolLabels)], "name", "reason"))
+}
+
+// NewPrometheusPoolMonitor new a prometheus pool monitor of the mongo pools.
+//
+// Deprecated: use NewPoolMonitor with WithAppName and WithGatewayAddress, which reports the invalid options as errors instead of panics.
 func NewPrometheusPoolMonitor(appName string, gatewayAddress string) *PrometheusPoolMonitor {
-	reg := prometheus.NewRegistry()
-	pool, conn, connOccupy := newMonitorPool(appName), newMonitorConn(appName), newMonitorConnOccupy(appName)
-	reg.MustRegister(
-		pool, conn, connOccupy,
-	)
+	m, err := newPrometheusPoolMonitor(newPoolMonitorConfig("mongo",
+		WithAppName(appName), WithGatewayAddress(gatewayAddress), WithJob("mongo-pool-monitor"),
+	))
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
 
-	return &PrometheusPoolMonitor{
-		prefix: appName,
-		p:      push.New(gatewayAddress, "mongo-pool-monitor").Gatherer(reg),
-		collectors: map[monitorKind]prometheus.Collector{
-			monitorKindPool:       pool,
-			monitorKindConn:       conn,
-			monitorKindConnOccupy: connOccupy,
-		},
+func newPrometheusPoolMonitor(c *poolMonitorConfig) (*PrometheusPoolMonitor, error) {
+	if err := c.validatePrometheus(); err != nil {
+		return nil, err
+	}
+	reg := c.registry
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	collectors := newPoolCollectors(c)
+	if err := collectors.register(reg); err != nil {
+		return nil, err
+	}
+
+	p := push.New(c.gatewayAddress, c.job).Gatherer(reg).Grouping("kind", c.dbType)
+	if _, ok := c.grouping["instance"]; !ok {
+		p = p.Grouping("instance", net.GetOutboundIP())
 	}
+	for name, value := range c.grouping {
+		p = p.Grouping(name, value)
+	}
+	m := &PrometheusPoolMonitor{
+		prefix:     c.appName,
+		p:          p,
+		collectors: collectors,
+		interval:   c.pushInterval,
+		retries:    c.pushRetries,
+		backoff:    c.pushBackoff,
+		onError:    c.onPushError,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go m.loop()
+	return m, nil
 }
 
 func (m *PrometheusPoolMonitor) Log(w io.Writer, args any) {
 	fmt.Fprintf(w, "prometheus pool monitor: %v", args)
 }
 
-func (c *PrometheusPoolMonitor) push() error {
-	if err := c.p.Grouping(
-		"kind", "mongo",
-	).Grouping(
-		"instance", net.GetOutboundIP(),
-	).Push(); err != nil {
-		return err
+// loop pushes the changed metrics every interval, and for the last time when the monitor is closed
+func (c *PrometheusPoolMonitor) loop() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.done:
+			c.lastErr = c.flush()
+			return
+		}
+	}
+}
+
+// flush pushes the metrics if they changed, a failed push is retried in the next flush
+func (c *PrometheusPoolMonitor) flush() error {
+	if atomic.SwapInt32(&c.dirty, 0) == 0 {
+		return nil
+	}
+	err := c.p.Push()
+	for attempt := 0; err != nil && attempt < c.retries; attempt++ {
+		time.Sleep(c.backoff << uint(attempt))
+		err = c.p.Push()
+	}
+	if err != nil {
+		atomic.StoreInt32(&c.dirty, 1)
+		c.reportError(err)
+	}
+	return err
+}
+
+func (c *PrometheusPoolMonitor) reportError(err error) {
+	if c.onError != nil {
+		c.onError(err)
+		return
 	}
+	if os.Getenv(DEBUG_ENV) != "" {
+		c.Log(os.Stderr, fmt.Sprintf("push: %s\n", err))
+	}
+}
+
+// Close stops the background push, the changed metrics are pushed for the last time
+func (c *PrometheusPoolMonitor) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	<-c.stopped
+	return c.lastErr
+}
+
+// push marks the metrics changed, they are pushed by the background loop
+func (c *PrometheusPoolMonitor) push() error {
+	atomic.StoreInt32(&c.dirty, 1)
 	return nil
 }
 
 func (c *PrometheusPoolMonitor) Pool(op PoolOperation) error {
+	return c.PoolAt("", op)
+}
+
+func (c *PrometheusPoolMonitor) PoolAt(address string, op PoolOperation) error {
+	c.collectors.pool(address, op)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) Conn(op ConnOperation) error {
+	return c.ConnAt("", op)
+}
+
+func (c *PrometheusPoolMonitor) ConnAt(address string, op ConnOperation) error {
+	c.collectors.conn(address, op)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) Checkout(op CheckoutOperation) error {
+	return c.CheckoutAt("", op)
+}
+
+func (c *PrometheusPoolMonitor) CheckoutAt(address string, op CheckoutOperation) error {
+	c.collectors.checkout(address, op)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) Heartbeat(address string, d time.Duration, err error) error {
+	c.collectors.heartbeat(address, d, err)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) Server(address string, op ServerOperation) error {
+	c.collectors.server(address, op)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) DBStats(name string, stats sql.DBStats) error {
+	c.collectors.sqlStats(name, stats)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) removeDBStats(name string) {
+	c.collectors.removeSQLStats(name)
+	c.push()
+}
+
+func (c *PrometheusPoolMonitor) RemoveAddress(address string) error {
+	c.collectors.removeAddress(address)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) CheckoutWait(address string, d time.Duration) error {
+	c.collectors.checkoutWait(address, d)
+	return c.push()
+}
+
+func (c *PrometheusPoolMonitor) Bulkhead(name string, op BulkheadOperation) error {
+	c.collectors.bulkhead(name, op)
+	return c.push()
+}
+
+// poolCollectors are the collectors shared by the push and the pull prometheus monitors
+type poolCollectors struct {
+	kinds   map[monitorKind]prometheus.Collector
+	dbStats dbStatsTracker
+	app     string
+	dbType  string
+	cluster string
+}
+
+func newPoolCollectors(c *poolMonitorConfig) *poolCollectors {
+	return &poolCollectors{
+		kinds: map[monitorKind]prometheus.Collector{
+			monitorKindPool:            newMonitorPool(c.subsystem),
+			monitorKindConn:            newMonitorConn(c.subsystem),
+			monitorKindConnOccupy:      newMonitorConnOccupy(c.subsystem),
+			monitorKindBulkheadQueue:   newMonitorBulkheadQueue(c.subsystem),
+			monitorKindBulkheadReject:  newMonitorBulkheadReject(c.subsystem),
+			monitorKindPoolClosed:      newMonitorPoolClosed(c.subsystem),
+			monitorKindConnReady:       newMonitorConnReady(c.subsystem),
+			monitorKindCheckout:        newMonitorCheckout(c.subsystem),
+			monitorKindCheckoutFailed:  newMonitorCheckoutFailed(c.subsystem),
+			monitorKindCheckoutWait:    newMonitorCheckoutWait(c.subsystem),
+			monitorKindHeartbeat:       newMonitorHeartbeat(c.subsystem),
+			monitorKindHeartbeatFailed: newMonitorHeartbeatFailed(c.subsystem),
+			monitorKindServer:          newMonitorServer(c.subsystem),
+			monitorKindSQLConns:        newMonitorSQLConns(c.subsystem),
+			monitorKindSQLWait:         newMonitorSQLWait(c.subsystem),
+			monitorKindSQLWaitSeconds:  newMonitorSQLWaitSeconds(c.subsystem),
+			monitorKindSQLClosed:       newMonitorSQLClosed(c.subsystem),
+		},
+		app:     c.appName,
+		dbType:  c.dbType,
+		cluster: c.cluster,
+	}
+}
+
+// register registers the metrics to reg, the ones already registered by another pool monitor are shared,
+// so that the monitors of different db types, apps or clusters can report to the same registerer
+func (c *poolCollectors) register(reg prometheus.Registerer) error {
+	for kind := monitorKindPool; kind <= monitorKindSQLClosed; kind++ {
+		err := reg.Register(c.kinds[kind])
+		if err == nil {
+			continue
+		}
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) || reflect.TypeOf(registered.ExistingCollector) != reflect.TypeOf(c.kinds[kind]) {
+			return fmt.Errorf("database: register pool monitor metrics: %w", err)
+		}
+		c.kinds[kind] = registered.ExistingCollector
+	}
+	return nil
+}
+
+// labelValues returns the values of poolLabels, followed by the extra ones
+func (c *poolCollectors) labelValues(address string, extra ...string) []string {
+	return append([]string{c.app, c.dbType, c.cluster, address}, extra...)
+}
+
+func (c *poolCollectors) gauge(kind monitorKind, values []string) prometheus.Gauge {
+	return c.kinds[kind].(*prometheus.GaugeVec).WithLabelValues(values...)
+}
+
+func (c *poolCollectors) counter(kind monitorKind, values []string) prometheus.Counter {
+	return c.kinds[kind].(*prometheus.CounterVec).WithLabelValues(values...)
+}
+
+func (c *poolCollectors) pool(address string, op PoolOperation) {
+	values := c.labelValues(address)
 	switch op {
 	case PoolCreate:
-		c.collectors[monitorKindPool].(prometheus.Gauge).Inc()
+		c.gauge(monitorKindPool, values).Inc()
 	case PoolClear:
-		c.collectors[monitorKindPool].(prometheus.Gauge).Dec()
+		c.gauge(monitorKindPool, values).Dec()
+	case PoolClose:
+		c.counter(monitorKindPoolClosed, values).Inc()
 	}
-	c.Lock()
-	defer c.Unlock()
-	return c.push()
 }
 
-func (c *PrometheusPoolMonitor) Conn(op ConnOperation) error {
+func (c *poolCollectors) conn(address string, op ConnOperation) {
+	values := c.labelValues(address)
 	switch op {
 	case ConnCreate:
-		c.collectors[monitorKindConn].(prometheus.Gauge).Inc()
+		c.gauge(monitorKindConn, values).Inc()
 	case ConnClose:
-		c.collectors[monitorKindConn].(prometheus.Gauge).Dec()
+		c.gauge(monitorKindConn, values).Dec()
 	case Connoccupy:
-		c.collectors[monitorKindConnOccupy].(prometheus.Gauge).Inc()
+		c.gauge(monitorKindConnOccupy, values).Inc()
 	case ConnRelease:
-		c.collectors[monitorKindConnOccupy].(prometheus.Gauge).Dec()
+		c.gauge(monitorKindConnOccupy, values).Dec()
+	case ConnReady:
+		c.counter(monitorKindConnReady, values).Inc()
 	}
-	c.Lock()
-	defer c.Unlock()
-	return c.push()
+}
+
+func (c *poolCollectors) checkout(address string, op CheckoutOperation) {
+	if op == CheckoutStart {
+		c.counter(monitorKindCheckout, c.labelValues(address)).Inc()
+		return
+	}
+	if reason := op.reason(); reason != "" {
+		c.counter(monitorKindCheckoutFailed, c.labelValues(address, reason)).Inc()
+	}
+}
+
+func (c *poolCollectors) heartbeat(address string, d time.Duration, err error) {
+	if err != nil {
+		c.counter(monitorKindHeartbeatFailed, c.labelValues(address)).Inc()
+		return
+	}
+	c.kinds[monitorKindHeartbeat].(*prometheus.HistogramVec).WithLabelValues(c.labelValues(address)...).Observe(d.Seconds())
+}
+
+func (c *poolCollectors) server(address string, op ServerOperation) {
+	if name := op.name(); name != "" {
+		c.counter(monitorKindServer, c.labelValues(address, name)).Inc()
+	}
+}
+
+func (c *poolCollectors) sqlStats(name string, stats sql.DBStats) {
+	for state, n := range map[string]int{
+		"open":     stats.OpenConnections,
+		"in_use":   stats.InUse,
+		"idle":     stats.Idle,
+		"max_open": stats.MaxOpenConnections,
+	} {
+		c.gauge(monitorKindSQLConns, c.labelValues("", name, state)).Set(float64(n))
+	}
+	delta := c.dbStats.delta(name, stats)
+	c.counter(monitorKindSQLWait, c.labelValues("", name)).Add(float64(delta.WaitCount))
+	c.counter(monitorKindSQLWaitSeconds, c.labelValues("", name)).Add(delta.WaitDuration.Seconds())
+	for reason, n := range map[string]int64{
+		"max_idle":      delta.MaxIdleClosed,
+		"max_idle_time": delta.MaxIdleTimeClosed,
+		"max_lifetime":  delta.MaxLifetimeClosed,
+	} {
+		c.counter(monitorKindSQLClosed, c.labelValues("", name, reason)).Add(float64(n))
+	}
+}
+
+// removeSQLStats deletes the series and forgets the last stats of the named database
+func (c *poolCollectors) removeSQLStats(name string) {
+	c.dbStats.remove(name)
+	for _, state := range []string{"open", "in_use", "idle", "max_open"} {
+		c.deleteSeries(monitorKindSQLConns, c.labelValues("", name, state))
+	}
+	c.deleteSeries(monitorKindSQLWait, c.labelValues("", name))
+	c.deleteSeries(monitorKindSQLWaitSeconds, c.labelValues("", name))
+	for _, reason := range []string{"max_idle", "max_idle_time", "max_lifetime"} {
+		c.deleteSeries(monitorKindSQLClosed, c.labelValues("", name, reason))
+	}
+}
+
+// removeAddress deletes the pool, connection and checkout series of the address, so that the pools of the servers
+// left the topology are not kept forever. The pool closes, the heartbeats and the server events are kept,
+// they are reported right before the removal and show the failovers.
+func (c *poolCollectors) removeAddress(address string) {
+	for _, kind := range []monitorKind{
+		monitorKindPool, monitorKindConn, monitorKindConnOccupy, monitorKindConnReady,
+		monitorKindCheckout, monitorKindCheckoutWait,
+	} {
+		c.deleteSeries(kind, c.labelValues(address))
+	}
+	for op := CheckoutTimeout; op <= CheckoutConnError; op++ {
+		c.deleteSeries(monitorKindCheckoutFailed, c.labelValues(address, op.reason()))
+	}
+}
+
+func (c *poolCollectors) deleteSeries(kind monitorKind, values []string) {
+	c.kinds[kind].(interface{ DeleteLabelValues(...string) bool }).DeleteLabelValues(values...)
+}
+
+func (c *poolCollectors) checkoutWait(address string, d time.Duration) {
+	c.kinds[monitorKindCheckoutWait].(*prometheus.HistogramVec).WithLabelValues(c.labelValues(address)...).Observe(d.Seconds())
+}
+
+func (c *poolCollectors) bulkhead(name string, op BulkheadOperation) {
+	values := c.labelValues("", name)
+	switch op {
+	case BulkheadEnqueue:
+		c.gauge(monitorKindBulkheadQueue, values).Inc()
+	case BulkheadDequeue:
+		c.gauge(monitorKindBulkheadQueue, values).Dec()
+	case BulkheadReject:
+		c.counter(monitorKindBulkheadReject, values).Inc()
+	}
+}
+
+// PrometheusPullPoolMonitor is the prometheus based monitor scraped by the prometheus server,
+// the events only update the metrics without any network I/O
+type PrometheusPullPoolMonitor struct {
+	collectors *poolCollectors
+	reg        *prometheus.Registry
+}
+
+func newPrometheusPullPoolMonitor(c *poolMonitorConfig) (*PrometheusPullPoolMonitor, error) {
+	if err := c.validatePrometheusPull(); err != nil {
+		return nil, err
+	}
+	m := &PrometheusPullPoolMonitor{
+		collectors: newPoolCollectors(c),
+		reg:        prometheus.NewRegistry(),
+	}
+	// the shared metrics of the registerer are adopted first, so that the handler serves the same ones
+	if c.registerer != nil {
+		if err := m.collectors.register(c.registerer); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.collectors.register(m.reg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Handler returns the http handler serving the pool metrics to the prometheus server
+func (m *PrometheusPullPoolMonitor) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+func (m *PrometheusPullPoolMonitor) Log(w io.Writer, args any) {
+	fmt.Fprintf(w, "prometheus pull pool monitor: %v", args)
+}
+
+func (m *PrometheusPullPoolMonitor) Pool(op PoolOperation) error {
+	return m.PoolAt("", op)
+}
+
+func (m *PrometheusPullPoolMonitor) PoolAt(address string, op PoolOperation) error {
+	m.collectors.pool(address, op)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) Conn(op ConnOperation) error {
+	return m.ConnAt("", op)
+}
+
+func (m *PrometheusPullPoolMonitor) ConnAt(address string, op ConnOperation) error {
+	m.collectors.conn(address, op)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) Checkout(op CheckoutOperation) error {
+	return m.CheckoutAt("", op)
+}
+
+func (m *PrometheusPullPoolMonitor) CheckoutAt(address string, op CheckoutOperation) error {
+	m.collectors.checkout(address, op)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) Heartbeat(address string, d time.Duration, err error) error {
+	m.collectors.heartbeat(address, d, err)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) Server(address string, op ServerOperation) error {
+	m.collectors.server(address, op)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) DBStats(name string, stats sql.DBStats) error {
+	m.collectors.sqlStats(name, stats)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) removeDBStats(name string) {
+	m.collectors.removeSQLStats(name)
+}
+
+func (m *PrometheusPullPoolMonitor) RemoveAddress(address string) error {
+	m.collectors.removeAddress(address)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) CheckoutWait(address string, d time.Duration) error {
+	m.collectors.checkoutWait(address, d)
+	return nil
+}
+
+func (m *PrometheusPullPoolMonitor) Bulkhead(name string, op BulkheadOperation) error {
+	m.collectors.bulkhead(name, op)
+	return nil
 }
 
 type DefaultPoolMonitor struct {
-	poolSize  int64
-	connNum   int64
-	occupyNum int64
+	poolSize   int64
+	poolClosed int64
+	connNum    int64
+	occupyNum  int64
+	readyNum   int64
+	checkouts  map[CheckoutOperation]int64
+	waits      map[string]*checkoutWaitStats
+	addresses  map[string]*addressStats
+	bulkheads  map[string]*bulkheadStats
 	sync.Mutex
 }
 
+type checkoutWaitStats struct {
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+type bulkheadStats struct {
+	queued   int64
+	rejected int64
+}
+
 func (c *DefaultPoolMonitor) Log(w io.Writer, a any) {}
 
 func (c *DefaultPoolMonitor) Pool(op PoolOperation) error {
+	return c.PoolAt("", op)
+}
+
+func (c *DefaultPoolMonitor) PoolAt(address string, op PoolOperation) error {
 	var s int64
 	switch op {
 	case PoolCreate:
 		s = atomic.AddInt64(&c.poolSize, 1)
+		c.track(address, ".pool", 1)
 	case PoolClear:
 		s = atomic.AddInt64(&c.poolSize, -1)
+		c.track(address, ".pool", -1)
+	case PoolClose:
+		log.Printf("closed pools: %d", atomic.AddInt64(&c.poolClosed, 1))
+		return nil
 	}
 	log.Printf("current pool size: %d", s)
-	c.Lock()
-	defer c.Unlock()
-	c.poolSize = s
 	return nil
 }
 
 func (c *DefaultPoolMonitor) Conn(op ConnOperation) error {
-	var s, o int64
+	return c.ConnAt("", op)
+}
+
+func (c *DefaultPoolMonitor) ConnAt(address string, op ConnOperation) error {
 	switch op {
 	case ConnCreate:
-		s = atomic.AddInt64(&c.connNum, 1)
+		atomic.AddInt64(&c.connNum, 1)
+		c.track(address, ".conn", 1)
 	case ConnClose:
-		s = atomic.AddInt64(&c.connNum, -1)
+		atomic.AddInt64(&c.connNum, -1)
+		c.track(address, ".conn", -1)
 	case Connoccupy:
-		o = atomic.AddInt64(&c.occupyNum, 1)
+		atomic.AddInt64(&c.occupyNum, 1)
+		c.track(address, ".conn.occupy", 1)
 	case ConnRelease:
-		o = atomic.AddInt64(&c.occupyNum, -1)
+		atomic.AddInt64(&c.occupyNum, -1)
+		c.track(address, ".conn.occupy", -1)
+	case ConnReady:
+		log.Printf("ready conns: %d", atomic.AddInt64(&c.readyNum, 1))
+		return nil
+	}
+	log.Printf("current pool size: %d, occupy : %d", atomic.LoadInt64(&c.connNum), atomic.LoadInt64(&c.occupyNum))
+	return nil
+}
+
+// track updates the state of the address if it is known
+func (c *DefaultPoolMonitor) track(address string, stat string, delta int64) {
+	if address == "" {
+		return
 	}
-	log.Printf("current pool size: %d, occupy : %d", s, o)
 	c.Lock()
 	defer c.Unlock()
-	c.connNum = s
-	c.occupyNum = o
+	if c.addresses == nil {
+		c.addresses = make(map[string]*addressStats)
+	}
+	s, ok := c.addresses[address]
+	if !ok {
+		s = &addressStats{}
+		c.addresses[address] = s
+	}
+	s.add(stat, delta)
+}
+
+func (c *DefaultPoolMonitor) Heartbeat(address string, d time.Duration, err error) error {
+	if err != nil {
+		log.Printf("heartbeat %s failed after %s: %s", address, d, err)
+	}
+	return nil
+}
+
+func (c *DefaultPoolMonitor) Server(address string, op ServerOperation) error {
+	log.Printf("server %s: %s", address, op.name())
+	return nil
+}
+
+func (c *DefaultPoolMonitor) DBStats(name string, stats sql.DBStats) error {
+	log.Printf("db %s open: %d, in use: %d, idle: %d, wait: %d (%s)",
+		name, stats.OpenConnections, stats.InUse, stats.Idle, stats.WaitCount, stats.WaitDuration)
+	return nil
+}
+
+// RemoveAddress drops the state of the address, and reverts what it still holds from the pools
+func (c *DefaultPoolMonitor) RemoveAddress(address string) error {
+	c.Lock()
+	s, ok := c.addresses[address]
+	delete(c.addresses, address)
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+	atomic.AddInt64(&c.poolSize, -s.pools)
+	atomic.AddInt64(&c.connNum, -s.conns)
+	atomic.AddInt64(&c.occupyNum, -s.occupied)
+	log.Printf("address %s removed, pools: %d, conns: %d, occupy: %d", address, s.pools, s.conns, s.occupied)
+	return nil
+}
+
+func (c *DefaultPoolMonitor) Checkout(op CheckoutOperation) error {
+	return c.CheckoutAt("", op)
+}
+
+func (c *DefaultPoolMonitor) CheckoutAt(address string, op CheckoutOperation) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.checkouts == nil {
+		c.checkouts = make(map[CheckoutOperation]int64)
+	}
+	c.checkouts[op]++
+	log.Printf("checkouts: %d, timeout: %d, pool closed: %d, conn error: %d",
+		c.checkouts[CheckoutStart], c.checkouts[CheckoutTimeout], c.checkouts[CheckoutPoolClosed], c.checkouts[CheckoutConnError])
+	return nil
+}
+
+func (c *DefaultPoolMonitor) CheckoutWait(address string, d time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.waits == nil {
+		c.waits = make(map[string]*checkoutWaitStats)
+	}
+	s, ok := c.waits[address]
+	if !ok {
+		s = &checkoutWaitStats{}
+		c.waits[address] = s
+	}
+	s.count++
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+	log.Printf("checkout wait %s: %s, avg: %s, max: %s", address, d, s.total/time.Duration(s.count), s.max)
+	return nil
+}
+
+func (c *DefaultPoolMonitor) Bulkhead(name string, op BulkheadOperation) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.bulkheads == nil {
+		c.bulkheads = make(map[string]*bulkheadStats)
+	}
+	s, ok := c.bulkheads[name]
+	if !ok {
+		s = &bulkheadStats{}
+		c.bulkheads[name] = s
+	}
+	switch op {
+	case BulkheadEnqueue:
+		s.queued++
+	case BulkheadDequeue:
+		s.queued--
+	case BulkheadReject:
+		s.rejected++
+	}
+	log.Printf("bulkhead %s queued: %d, rejected: %d", name, s.queued, s.rejected)
 	return nil
 }
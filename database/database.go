@@ -39,7 +39,8 @@ type TracerOption interface {
 
 // do gets the opentracing's global tracer ,and add span tags
 // The tags in `Do` will follow the [opentracing spec](https://github.com/opentracing/specification/blob/master/semantic_conventions.md#span-tags-table)
-func (t *tracer) do(ctx context.Context) {
+// The returned context carries the new span, so the wrapped funcs can start child spans of it.
+func (t *tracer) do(ctx context.Context) context.Context {
 	tracer := opentracing.GlobalTracer()
 	span := opentracing.SpanFromContext(ctx)
 	if span == nil {
@@ -51,8 +52,8 @@ func (t *tracer) do(ctx context.Context) {
 	tags.DBStatement.Set(span, t.statement)
 	tags.DBType.Set(span, t.dbtype)
 	tags.DBUser.Set(span, t.user)
-	opentracing.ContextWithSpan(ctx, span)
 	t.span = span
+	return opentracing.ContextWithSpan(ctx, span)
 }
 
 // close closes the opentracing's span
@@ -125,7 +126,7 @@ type TracerWrapper struct {
 func (t *TracerWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
 	tracerFn := func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 		t.tracer.statement = t.hackQueryBuilder(query, args...)
-		t.tracer.do(ctx)
+		ctx = t.tracer.do(ctx)
 		defer t.tracer.close()
 		return fn(ctx, query, args...)
 	}
@@ -136,7 +137,7 @@ func (t *TracerWrapper) WrapQueryContext(fn QueryContextFunc, query string, args
 func (t *TracerWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
 	tracerFn := func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 		t.tracer.statement = t.hackQueryBuilder(query, args...)
-		t.tracer.do(ctx)
+		ctx = t.tracer.do(ctx)
 		defer t.tracer.close()
 		return fn(ctx, query, args...)
 	}
@@ -0,0 +1,67 @@
+package databasetest
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// AssertStatementSeen fails the test unless a finished span of t is tagged with statement,
+// the span is returned for more assertions
+func AssertStatementSeen(tb testing.TB, t *Tracer, statement string) *mocktracer.MockSpan {
+	tb.Helper()
+	span := t.SpanByStatement(statement)
+	if span == nil {
+		tb.Errorf("statement %q not seen, seen: %q", statement, t.Statements())
+	}
+	return span
+}
+
+// AssertTag fails the test unless span has the tag key with value want
+func AssertTag(tb testing.TB, span *mocktracer.MockSpan, key string, want interface{}) {
+	tb.Helper()
+	if span == nil {
+		tb.Errorf("tag %s: span is nil", key)
+		return
+	}
+	if got := span.Tag(key); got != want {
+		tb.Errorf("tag %s = %v, want %v", key, got, want)
+	}
+}
+
+// AssertChildOf fails the test unless child is a child span of parent in the same trace
+func AssertChildOf(tb testing.TB, child, parent *mocktracer.MockSpan) {
+	tb.Helper()
+	if child == nil || parent == nil {
+		tb.Errorf("child of: span is nil")
+		return
+	}
+	pc, cc := parent.Context().(mocktracer.MockSpanContext), child.Context().(mocktracer.MockSpanContext)
+	if child.ParentID != pc.SpanID || cc.TraceID != pc.TraceID {
+		tb.Errorf("span %q (parent %d) is not a child of span %q (%d)", child.OperationName, child.ParentID, parent.OperationName, pc.SpanID)
+	}
+}
+
+// AssertPoolSize fails the test unless the pool size reported to m is want
+func AssertPoolSize(tb testing.TB, m *Monitor, want int64) {
+	tb.Helper()
+	if got := m.PoolSize(); got != want {
+		tb.Errorf("pool size = %d, want %d", got, want)
+	}
+}
+
+// AssertConns fails the test unless the connections reported to m are want
+func AssertConns(tb testing.TB, m *Monitor, want int64) {
+	tb.Helper()
+	if got := m.Conns(); got != want {
+		tb.Errorf("conns = %d, want %d", got, want)
+	}
+}
+
+// AssertOccupied fails the test unless the occupied connections reported to m are want
+func AssertOccupied(tb testing.TB, m *Monitor, want int64) {
+	tb.Helper()
+	if got := m.Occupied(); got != want {
+		tb.Errorf("occupied conns = %d, want %d", got, want)
+	}
+}
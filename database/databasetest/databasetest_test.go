@@ -0,0 +1,109 @@
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ezbuy/wrapper/database"
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := InstallTracer(t)
+	parent := tracer.StartSpan("handler")
+	ctx := opentracing.ContextWithSpan(context.TODO(), parent)
+
+	fn := database.QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"a"}))
+		return db.QueryContext(ctx, query, args...)
+	})
+	rows, err := database.NewMySQLTracerWrapper().WrapQueryContext(fn, "SELECT a FROM b WHERE c = ?", "d")(ctx, "SELECT a FROM b WHERE c = ?", "d")
+	if err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	rows.Close()
+	parent.Finish()
+
+	span := AssertStatementSeen(t, tracer, "SELECT ... FROM b WHERE c = ?")
+	AssertTag(t, span, string(tags.DBType), "mysql")
+	AssertChildOf(t, span, parent.(*mocktracer.MockSpan))
+	if opentracing.GlobalTracer() != tracer {
+		t.Errorf("global tracer is not installed")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	m := NewMonitor()
+	pm := database.NewMongoDriverMonitor(m)
+	for _, typ := range []string{
+		event.PoolCreated,
+		event.ConnectionCreated,
+		event.ConnectionCreated,
+		event.GetSucceeded,
+		event.GetSucceeded,
+		event.ConnectionReturned,
+		event.ConnectionClosed,
+	} {
+		pm.Event(&event.PoolEvent{Type: typ})
+	}
+	AssertPoolSize(t, m, 1)
+	AssertConns(t, m, 1)
+	AssertOccupied(t, m, 1)
+	if n := m.ConnCount(database.ConnCreate); n != 2 {
+		t.Errorf("ConnCount(ConnCreate) = %d, want 2", n)
+	}
+}
+
+func TestMonitor_Address(t *testing.T) {
+	m := NewMonitor()
+	pm := database.NewMongoDriverMonitor(m)
+	for _, address := range []string{"a:27017", "b:27017"} {
+		pm.Event(&event.PoolEvent{Type: event.PoolCreated, Address: address})
+		pm.Event(&event.PoolEvent{Type: event.ConnectionCreated, Address: address})
+		pm.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: address})
+	}
+	pm.Event(&event.PoolEvent{Type: event.PoolClosedEvent, Address: "b:27017"})
+
+	if n := m.AddressConns("a:27017"); n != 1 {
+		t.Errorf("AddressConns() = %d, want 1", n)
+	}
+	if n := m.AddressConns("b:27017"); n != 0 {
+		t.Errorf("AddressConns() of the removed address = %d, want 0", n)
+	}
+	if got := m.RemovedAddresses(); len(got) != 1 || got[0] != "b:27017" {
+		t.Errorf("RemovedAddresses() = %v, want [b:27017]", got)
+	}
+	// the counts keep the operations of the removed address
+	if n := m.ConnCount(database.ConnCreate); n != 2 {
+		t.Errorf("ConnCount() = %d, want 2", n)
+	}
+	AssertPoolSize(t, m, 1)
+	AssertConns(t, m, 1)
+	if n := m.Occupied(); n != 1 {
+		t.Errorf("Occupied() = %d, want 1", n)
+	}
+}
+
+func TestMonitor_Server(t *testing.T) {
+	m := NewMonitor()
+	sm := database.NewMongoServerMonitor(m)
+	sm.ServerOpening(&event.ServerOpeningEvent{Address: "a:27017"})
+	sm.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{ConnectionID: "a:27017[-1]"})
+	sm.ServerHeartbeatFailed(&event.ServerHeartbeatFailedEvent{ConnectionID: "a:27017[-1]"})
+
+	if got := m.ServerAddresses(database.ServerOpen); len(got) != 1 || got[0] != "a:27017" {
+		t.Errorf("ServerAddresses() = %v, want [a:27017]", got)
+	}
+	if succeeded, failed := m.Heartbeats("a:27017"); succeeded != 1 || failed != 1 {
+		t.Errorf("Heartbeats() = %d, %d, want 1 and 1", succeeded, failed)
+	}
+}
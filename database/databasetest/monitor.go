@@ -0,0 +1,309 @@
+package databasetest
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ezbuy/wrapper/database"
+)
+
+var (
+	_ database.AddressMonitor      = (*Monitor)(nil)
+	_ database.CheckoutWaitMonitor = (*Monitor)(nil)
+	_ database.TopologyMonitor     = (*Monitor)(nil)
+	_ database.DBStatsMonitor      = (*Monitor)(nil)
+)
+
+// Monitor is a recording database.Monitor, it counts every operation and keeps the logs.
+// The counts include every reported operation, while the pools and the connections a removed address
+// still holds are reverted from PoolSize, Conns and Occupied, as database.DefaultPoolMonitor does.
+type Monitor struct {
+	pools     map[database.PoolOperation]int64
+	conns     map[database.ConnOperation]int64
+	checkouts map[database.CheckoutOperation]int64
+	waits     map[string][]time.Duration
+	addresses map[string]*addressState
+	dropped   addressState
+	removed   []string
+	servers   map[database.ServerOperation][]string
+	beats     map[string]int64
+	failures  map[string]int64
+	dbStats   map[string]sql.DBStats
+	bulkheads map[string]map[database.BulkheadOperation]int64
+	logs      []string
+	sync.Mutex
+}
+
+// addressState is what a server address holds from the pools
+type addressState struct {
+	pools    int64
+	conns    int64
+	occupied int64
+}
+
+// NewMonitor new a recording monitor
+func NewMonitor() *Monitor {
+	return &Monitor{
+		pools:     make(map[database.PoolOperation]int64),
+		conns:     make(map[database.ConnOperation]int64),
+		checkouts: make(map[database.CheckoutOperation]int64),
+		waits:     make(map[string][]time.Duration),
+		addresses: make(map[string]*addressState),
+		servers:   make(map[database.ServerOperation][]string),
+		beats:     make(map[string]int64),
+		failures:  make(map[string]int64),
+		dbStats:   make(map[string]sql.DBStats),
+		bulkheads: make(map[string]map[database.BulkheadOperation]int64),
+	}
+}
+
+// Log impls database.Logger
+func (m *Monitor) Log(_ io.Writer, a any) {
+	m.Lock()
+	defer m.Unlock()
+	m.logs = append(m.logs, fmt.Sprint(a))
+}
+
+// Pool impls database.Monitor
+func (m *Monitor) Pool(op database.PoolOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.pools[op]++
+	return nil
+}
+
+// Conn impls database.Monitor
+func (m *Monitor) Conn(op database.ConnOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.conns[op]++
+	return nil
+}
+
+// Checkout impls database.Monitor
+func (m *Monitor) Checkout(op database.CheckoutOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.checkouts[op]++
+	return nil
+}
+
+// PoolAt impls database.AddressMonitor, the operation is counted as Pool does and tracked for the address
+func (m *Monitor) PoolAt(address string, op database.PoolOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.pools[op]++
+	if s := m.address(address); s != nil {
+		switch op {
+		case database.PoolCreate:
+			s.pools++
+		case database.PoolClear:
+			s.pools--
+		}
+	}
+	return nil
+}
+
+// ConnAt impls database.AddressMonitor, the operation is counted as Conn does and tracked for the address
+func (m *Monitor) ConnAt(address string, op database.ConnOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.conns[op]++
+	if s := m.address(address); s != nil {
+		switch op {
+		case database.ConnCreate:
+			s.conns++
+		case database.ConnClose:
+			s.conns--
+		case database.Connoccupy:
+			s.occupied++
+		case database.ConnRelease:
+			s.occupied--
+		}
+	}
+	return nil
+}
+
+// CheckoutAt impls database.AddressMonitor, the operation is counted as Checkout does
+func (m *Monitor) CheckoutAt(_ string, op database.CheckoutOperation) error {
+	return m.Checkout(op)
+}
+
+// RemoveAddress impls database.AddressMonitor, what the address still holds is reverted from PoolSize, Conns and Occupied
+func (m *Monitor) RemoveAddress(address string) error {
+	m.Lock()
+	defer m.Unlock()
+	if s, ok := m.addresses[address]; ok {
+		m.dropped.pools += s.pools
+		m.dropped.conns += s.conns
+		m.dropped.occupied += s.occupied
+		delete(m.addresses, address)
+	}
+	m.removed = append(m.removed, address)
+	return nil
+}
+
+// address returns the state of the address, nil for the operations without one
+func (m *Monitor) address(address string) *addressState {
+	if address == "" {
+		return nil
+	}
+	s, ok := m.addresses[address]
+	if !ok {
+		s = &addressState{}
+		m.addresses[address] = s
+	}
+	return s
+}
+
+// Heartbeat impls database.TopologyMonitor
+func (m *Monitor) Heartbeat(address string, _ time.Duration, err error) error {
+	m.Lock()
+	defer m.Unlock()
+	if err != nil {
+		m.failures[address]++
+		return nil
+	}
+	m.beats[address]++
+	return nil
+}
+
+// Server impls database.TopologyMonitor
+func (m *Monitor) Server(address string, op database.ServerOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	m.servers[op] = append(m.servers[op], address)
+	return nil
+}
+
+// DBStats impls database.DBStatsMonitor, the last stats of every database are kept
+func (m *Monitor) DBStats(name string, stats sql.DBStats) error {
+	m.Lock()
+	defer m.Unlock()
+	m.dbStats[name] = stats
+	return nil
+}
+
+// CheckoutWait impls database.CheckoutWaitMonitor
+func (m *Monitor) CheckoutWait(address string, d time.Duration) error {
+	m.Lock()
+	defer m.Unlock()
+	m.waits[address] = append(m.waits[address], d)
+	return nil
+}
+
+// Bulkhead impls database.Monitor
+func (m *Monitor) Bulkhead(name string, op database.BulkheadOperation) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.bulkheads[name] == nil {
+		m.bulkheads[name] = make(map[database.BulkheadOperation]int64)
+	}
+	m.bulkheads[name][op]++
+	return nil
+}
+
+// PoolCount returns how many times op is reported
+func (m *Monitor) PoolCount(op database.PoolOperation) int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.pools[op]
+}
+
+// ConnCount returns how many times op is reported
+func (m *Monitor) ConnCount(op database.ConnOperation) int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.conns[op]
+}
+
+// CheckoutCount returns how many times op is reported
+func (m *Monitor) CheckoutCount(op database.CheckoutOperation) int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.checkouts[op]
+}
+
+// CheckoutWaits returns the reported checkout waits of the server address
+func (m *Monitor) CheckoutWaits(address string) []time.Duration {
+	m.Lock()
+	defer m.Unlock()
+	return append([]time.Duration(nil), m.waits[address]...)
+}
+
+// BulkheadCount returns how many times op is reported for the named bulkhead
+func (m *Monitor) BulkheadCount(name string, op database.BulkheadOperation) int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.bulkheads[name][op]
+}
+
+// PoolSize returns the created pools minus the cleared ones and the ones of the removed addresses
+func (m *Monitor) PoolSize() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.pools[database.PoolCreate] - m.pools[database.PoolClear] - m.dropped.pools
+}
+
+// Conns returns the created connections minus the closed ones and the ones of the removed addresses
+func (m *Monitor) Conns() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.conns[database.ConnCreate] - m.conns[database.ConnClose] - m.dropped.conns
+}
+
+// Occupied returns the occupied connections minus the released ones and the ones of the removed addresses
+func (m *Monitor) Occupied() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.conns[database.Connoccupy] - m.conns[database.ConnRelease] - m.dropped.occupied
+}
+
+// AddressConns returns the created connections minus the closed ones of the address
+func (m *Monitor) AddressConns(address string) int64 {
+	m.Lock()
+	defer m.Unlock()
+	if s, ok := m.addresses[address]; ok {
+		return s.conns
+	}
+	return 0
+}
+
+// RemovedAddresses returns the removed addresses in order
+func (m *Monitor) RemovedAddresses() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.removed...)
+}
+
+// Heartbeats returns the succeeded and the failed heartbeats of the address
+func (m *Monitor) Heartbeats(address string) (succeeded, failed int64) {
+	m.Lock()
+	defer m.Unlock()
+	return m.beats[address], m.failures[address]
+}
+
+// ServerAddresses returns the addresses op is reported on in order
+func (m *Monitor) ServerAddresses(op database.ServerOperation) []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.servers[op]...)
+}
+
+// LastDBStats returns the last reported stats of the named database, false if there are none
+func (m *Monitor) LastDBStats(name string) (sql.DBStats, bool) {
+	m.Lock()
+	defer m.Unlock()
+	stats, ok := m.dbStats[name]
+	return stats, ok
+}
+
+// Logs returns the logged messages
+func (m *Monitor) Logs() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.logs...)
+}
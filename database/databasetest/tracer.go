@@ -0,0 +1,57 @@
+// Package databasetest provides the recording tracer, the recording monitor and the assertions
+// to test the code instrumented by the database package.
+package databasetest
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// Tracer is a recording tracer, all spans finished through it can be inspected
+type Tracer struct {
+	*mocktracer.MockTracer
+}
+
+// NewTracer new a recording tracer
+func NewTracer() *Tracer {
+	return &Tracer{
+		MockTracer: mocktracer.New(),
+	}
+}
+
+// InstallTracer sets a new recording tracer as the opentracing global tracer,
+// the previous global tracer is restored when the test ends
+func InstallTracer(tb testing.TB) *Tracer {
+	tb.Helper()
+	previous := opentracing.GlobalTracer()
+	t := NewTracer()
+	opentracing.SetGlobalTracer(t)
+	tb.Cleanup(func() {
+		opentracing.SetGlobalTracer(previous)
+	})
+	return t
+}
+
+// Statements returns the db.statement tags of the finished spans, in the order they finished
+func (t *Tracer) Statements() []string {
+	var statements []string
+	for _, span := range t.FinishedSpans() {
+		if st, ok := span.Tag(string(tags.DBStatement)).(string); ok {
+			statements = append(statements, st)
+		}
+	}
+	return statements
+}
+
+// SpanByStatement returns the first finished span tagged with statement, or nil if none
+func (t *Tracer) SpanByStatement(statement string) *mocktracer.MockSpan {
+	for _, span := range t.FinishedSpans() {
+		if span.Tag(string(tags.DBStatement)) == statement {
+			return span
+		}
+	}
+	return nil
+}
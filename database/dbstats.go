@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultDBStatsInterval = 10 * time.Second
+
+// DBStatsMonitor is a Monitor of the database/sql pools as well, such as the MySQL and the MsSQL ones
+type DBStatsMonitor interface {
+	Monitor
+	// DBStats reports the stats of the named database, the counters in stats are the totals since it is opened
+	DBStats(name string, stats sql.DBStats) error
+}
+
+// dbStatsRemover is implemented by the monitors keeping the last stats or the series of the databases,
+// they are dropped when the database is unregistered
+type dbStatsRemover interface {
+	removeDBStats(name string)
+}
+
+var (
+	_ DBStatsMonitor = (*StatsDPoolMonitor)(nil)
+	_ DBStatsMonitor = (*PrometheusPoolMonitor)(nil)
+	_ DBStatsMonitor = (*PrometheusPullPoolMonitor)(nil)
+	_ DBStatsMonitor = (*DefaultPoolMonitor)(nil)
+)
+
+// DBStatsCollector reads the stats of the registered databases every interval, and reports them to the monitor
+type DBStatsCollector struct {
+	monitor  DBStatsMonitor
+	interval time.Duration
+	dbs      map[string]*sql.DB
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+	sync.Mutex
+}
+
+// DBStatsOption defines the db stats collector's option
+type DBStatsOption func(*DBStatsCollector)
+
+// WithDBStatsInterval sets how often the stats are read, it is 10s by default
+func WithDBStatsInterval(d time.Duration) DBStatsOption {
+	return func(c *DBStatsCollector) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// NewDBStatsCollector new a db stats collector reporting to m, which runs until it is closed
+func NewDBStatsCollector(m DBStatsMonitor, options ...DBStatsOption) *DBStatsCollector {
+	c := &DBStatsCollector{
+		monitor:  m,
+		interval: defaultDBStatsInterval,
+		dbs:      make(map[string]*sql.DB),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for _, op := range options {
+		op(c)
+	}
+	go c.loop()
+	return c
+}
+
+// Register adds the database db with the name, which is the "name" of its stats and metrics
+func (c *DBStatsCollector) Register(name string, db *sql.DB) error {
+	if name == "" {
+		return errors.New("database: db stats name is required")
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.dbs[name]; ok {
+		return fmt.Errorf("database: db stats of %q are already registered", name)
+	}
+	c.dbs[name] = db
+	return nil
+}
+
+// Unregister removes the named database, the monitor forgets its last stats and deletes its series
+// so that the name can be registered again with another database
+func (c *DBStatsCollector) Unregister(name string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.dbs, name)
+	if r, ok := c.monitor.(dbStatsRemover); ok {
+		r.removeDBStats(name)
+	}
+}
+
+// Collect reads and reports the stats of the registered databases once
+func (c *DBStatsCollector) Collect() {
+	c.Lock()
+	dbs := make(map[string]*sql.DB, len(c.dbs))
+	for name, db := range c.dbs {
+		dbs[name] = db
+	}
+	c.Unlock()
+	for name, db := range dbs {
+		if err := c.monitor.DBStats(name, db.Stats()); err != nil && os.Getenv(DEBUG_ENV) != "" {
+			c.monitor.Log(os.Stderr, fmt.Sprintf("db stats: %s: %s\n", name, err))
+		}
+	}
+}
+
+func (c *DBStatsCollector) loop() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Collect()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops collecting the stats, the databases are not closed
+func (c *DBStatsCollector) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	<-c.stopped
+	return nil
+}
+
+// dbStatsTracker keeps the last stats of the databases, so that the monitors can report the counters by deltas
+type dbStatsTracker struct {
+	last map[string]sql.DBStats
+	sync.Mutex
+}
+
+// delta returns the counters of stats increased since the last stats of the name.
+// A counter lower than the last one was reset, such as by another database of the same name, its total is returned.
+func (t *dbStatsTracker) delta(name string, stats sql.DBStats) sql.DBStats {
+	t.Lock()
+	defer t.Unlock()
+	if t.last == nil {
+		t.last = make(map[string]sql.DBStats)
+	}
+	last := t.last[name]
+	t.last[name] = stats
+	return sql.DBStats{
+		WaitCount:         counterDelta(stats.WaitCount, last.WaitCount),
+		WaitDuration:      time.Duration(counterDelta(int64(stats.WaitDuration), int64(last.WaitDuration))),
+		MaxIdleClosed:     counterDelta(stats.MaxIdleClosed, last.MaxIdleClosed),
+		MaxIdleTimeClosed: counterDelta(stats.MaxIdleTimeClosed, last.MaxIdleTimeClosed),
+		MaxLifetimeClosed: counterDelta(stats.MaxLifetimeClosed, last.MaxLifetimeClosed),
+	}
+}
+
+// remove drops the last stats of the name
+func (t *dbStatsTracker) remove(name string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.last, name)
+}
+
+// counterDelta returns how much the counter increased from last, the counter itself if it was reset
+func counterDelta(counter, last int64) int64 {
+	if counter < last {
+		return counter
+	}
+	return counter - last
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// dbStatsRecorder passes the reported stats to a channel on top of the default monitor
+type dbStatsRecorder struct {
+	DefaultPoolMonitor
+	stats chan sql.DBStats
+}
+
+func (r *dbStatsRecorder) DBStats(name string, stats sql.DBStats) error {
+	r.stats <- stats
+	return nil
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock sql conn failed:%v", err.Error())
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	r := &dbStatsRecorder{stats: make(chan sql.DBStats, 10)}
+	c := NewDBStatsCollector(r, WithDBStatsInterval(10*time.Millisecond))
+	defer c.Close()
+	if err := c.Register("main", db); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := c.Register("main", db); err == nil {
+		t.Errorf("Register() the same name twice error = nil")
+	}
+	if err := c.Register("", db); err == nil {
+		t.Errorf("Register() without name error = nil")
+	}
+
+	select {
+	case stats := <-r.stats:
+		if stats.MaxOpenConnections != 7 {
+			t.Errorf("MaxOpenConnections = %d, want 7", stats.MaxOpenConnections)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("stats not reported")
+	}
+}
+
+func TestDBStatsTracker_delta(t *testing.T) {
+	var tracker dbStatsTracker
+	tracker.delta("main", sql.DBStats{WaitCount: 3, WaitDuration: time.Second, MaxLifetimeClosed: 1})
+	got := tracker.delta("main", sql.DBStats{OpenConnections: 5, WaitCount: 5, WaitDuration: 3 * time.Second, MaxLifetimeClosed: 1})
+	if want := (sql.DBStats{WaitCount: 2, WaitDuration: 2 * time.Second}); got != want {
+		t.Errorf("delta() = %+v, want %+v", got, want)
+	}
+	if got := tracker.delta("other", sql.DBStats{WaitCount: 1}); got.WaitCount != 1 {
+		t.Errorf("delta() of a new name = %+v, want the totals", got)
+	}
+	// the counters of another database of the same name are reset
+	got = tracker.delta("main", sql.DBStats{WaitCount: 1, WaitDuration: time.Second, MaxLifetimeClosed: 2})
+	if want := (sql.DBStats{WaitCount: 1, WaitDuration: time.Second, MaxLifetimeClosed: 1}); got != want {
+		t.Errorf("delta() of reset counters = %+v, want %+v", got, want)
+	}
+	tracker.remove("main")
+	if got := tracker.delta("main", sql.DBStats{WaitCount: 4}); got.WaitCount != 4 {
+		t.Errorf("delta() of a removed name = %+v, want the totals", got)
+	}
+}
+
+func TestDBStatsCollector_Unregister(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPoolMonitor("mysql", PrometheusPull, WithAppName("my-app"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewPoolMonitor() error = %v", err)
+	}
+	sm := m.(DBStatsMonitor)
+	c := NewDBStatsCollector(NewMultiMonitor(sm), WithDBStatsInterval(time.Hour))
+	defer c.Close()
+
+	wait := m.(*PrometheusPullPoolMonitor).collectors.counter(monitorKindSQLWait, []string{"my-app", "mysql", "", "", "main"})
+	if err := sm.DBStats("main", sql.DBStats{WaitCount: 10}); err != nil {
+		t.Fatalf("DBStats() error = %v", err)
+	}
+	// a lower total must not panic the counter
+	if err := sm.DBStats("main", sql.DBStats{WaitCount: 1}); err != nil {
+		t.Fatalf("DBStats() error = %v", err)
+	}
+	if got := testutil.ToFloat64(wait); got != 11 {
+		t.Errorf("sql_wait_total = %v, want 11", got)
+	}
+	if n, err := testutil.GatherAndCount(reg, "database_sql_connections"); err != nil || n != 4 {
+		t.Errorf("GatherAndCount(database_sql_connections) = %d, %v, want 4", n, err)
+	}
+
+	c.Unregister("main")
+	for _, name := range []string{"database_sql_connections", "database_sql_wait_total", "database_sql_wait_seconds_total", "database_sql_closed_total"} {
+		if n, err := testutil.GatherAndCount(reg, name); err != nil || n != 0 {
+			t.Errorf("GatherAndCount(%s) after Unregister() = %d, %v, want 0", name, n, err)
+		}
+	}
+
+	// a database registered again under the name counts from its totals
+	if err := sm.DBStats("main", sql.DBStats{WaitCount: 3}); err != nil {
+		t.Fatalf("DBStats() error = %v", err)
+	}
+	wait = m.(*PrometheusPullPoolMonitor).collectors.counter(monitorKindSQLWait, []string{"my-app", "mysql", "", "", "main"})
+	if got := testutil.ToFloat64(wait); got != 3 {
+		t.Errorf("sql_wait_total after Unregister() = %v, want 3", got)
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// TxBeginner defines how the dry run wrapper begins a transaction, *sql.DB and *sqlx.DB are both TxBeginners
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// dryRunRollbackVerbs are the statements which can be rolled back,
+// the other ones such as DROP, ALTER, CREATE, TRUNCATE and RENAME commit the transaction implicitly in MySQL
+var dryRunRollbackVerbs = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+type dryRunKey struct{}
+
+// ContextWithDryRun switches the dry run on or off for the execs called with the returned context,
+// it takes precedence over the wrapper's option
+func ContextWithDryRun(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, enabled)
+}
+
+// DryRunWrapper defines a dry run wrapper
+// which logs the interpolated exec statements instead of executing them, and returns a synthetic sql.Result.
+// The queries are not touched.
+type DryRunWrapper struct {
+	enabled bool
+	db      TxBeginner
+	logger  Logger
+}
+
+// DryRunOption defines the dry run wrapper's option
+type DryRunOption func(*DryRunWrapper)
+
+// WithDryRunEnabled switches the dry run on or off by default, it is on unless set
+func WithDryRunEnabled(enabled bool) DryRunOption {
+	return func(w *DryRunWrapper) {
+		w.enabled = enabled
+	}
+}
+
+// WithDryRunRollback executes the INSERT, UPDATE, DELETE and REPLACE statements in a transaction of db
+// which is always rolled back, so the rows affected can be reported.
+// The other statements are only logged: a DDL commits the transaction implicitly and would change the schema.
+func WithDryRunRollback(db TxBeginner) DryRunOption {
+	return func(w *DryRunWrapper) {
+		w.db = db
+	}
+}
+
+// WithDryRunLogger logs the statements to l instead of the standard logger
+func WithDryRunLogger(l Logger) DryRunOption {
+	return func(w *DryRunWrapper) {
+		w.logger = l
+	}
+}
+
+// NewDryRunWrapper new a dry run wrapper
+func NewDryRunWrapper(options ...DryRunOption) *DryRunWrapper {
+	w := &DryRunWrapper{
+		enabled: true,
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext, the queries are executed as usual
+func (w *DryRunWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return fn
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *DryRunWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if !w.isEnabled(ctx) {
+			return fn(ctx, query, args...)
+		}
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag("db.dry_run", true)
+		}
+		statement := interpolate(query, args)
+		if w.db == nil || !dryRunRollbackVerbs[statementVerb(query)] {
+			w.log(fmt.Sprintf("dry run: %s\n", statement))
+			return result{}, nil
+		}
+		n, err := w.rollback(ctx, query, args)
+		if err != nil {
+			w.log(fmt.Sprintf("dry run: %s (error: %s)\n", statement, err))
+			return nil, err
+		}
+		w.log(fmt.Sprintf("dry run: %s (rows affected: %d)\n", statement, n))
+		return result{rowsAffected: n}, nil
+	}
+}
+
+func (w *DryRunWrapper) isEnabled(ctx context.Context) bool {
+	if enabled, ok := ctx.Value(dryRunKey{}).(bool); ok {
+		return enabled
+	}
+	return w.enabled
+}
+
+// rollback executes the statement in a transaction and rolls it back, the rows affected are returned
+func (w *DryRunWrapper) rollback(ctx context.Context, query string, args []interface{}) (int64, error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (w *DryRunWrapper) log(msg string) {
+	if w.logger == nil {
+		log.Print(msg)
+		return
+	}
+	w.logger.Log(os.Stdout, msg)
+}
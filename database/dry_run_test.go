@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDryRunWrapper_WrapExecContext(t *testing.T) {
+	calls := 0
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		calls++
+		return sqlmock.NewResult(0, 1), nil
+	})
+	logger := &transitionLogger{}
+	exec := NewDryRunWrapper(WithDryRunLogger(logger)).WrapExecContext(fn, "")
+
+	res, err := exec(context.TODO(), "UPDATE a SET b = ? WHERE c = ?", "it's", 1)
+	if err != nil {
+		t.Fatalf("exec() error = %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 || calls != 0 {
+		t.Errorf("dry run rows affected = %d, calls = %d, want 0 and 0", n, calls)
+	}
+	if want := "dry run: UPDATE a SET b = 'it''s' WHERE c = 1\n"; len(logger.logs) != 1 || logger.logs[0] != want {
+		t.Errorf("logs = %q, want %q", logger.logs, want)
+	}
+
+	if _, err := exec(ContextWithDryRun(context.TODO(), false), "UPDATE a SET b = 1"); err != nil || calls != 1 {
+		t.Errorf("exec() with dry run off error = %v, calls = %d", err, calls)
+	}
+}
+
+func TestDryRunWrapper_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock sql conn failed:%v", err.Error())
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM a").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectRollback()
+
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		t.Errorf("exec called in dry run")
+		return nil, nil
+	})
+	exec := NewDryRunWrapper(WithDryRunRollback(db), WithDryRunLogger(&transitionLogger{})).WrapExecContext(fn, "")
+	res, err := exec(context.TODO(), "DELETE FROM a WHERE b = ?", 1)
+	if err != nil {
+		t.Fatalf("exec() error = %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 5 {
+		t.Errorf("RowsAffected() = %d, want 5", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectations: %v", err)
+	}
+}
+
+func TestDryRunWrapper_RollbackDDL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock sql conn failed:%v", err.Error())
+	}
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		t.Errorf("exec called in dry run")
+		return nil, nil
+	})
+	logger := &transitionLogger{}
+	exec := NewDryRunWrapper(WithDryRunRollback(db), WithDryRunLogger(logger)).WrapExecContext(fn, "")
+	for _, query := range []string{"DROP TABLE a", "ALTER TABLE a ADD b INT", "TRUNCATE TABLE a", "RENAME TABLE a TO b"} {
+		if _, err := exec(context.TODO(), query); err != nil {
+			t.Errorf("exec(%q) error = %v", query, err)
+		}
+	}
+	if len(logger.logs) != 4 {
+		t.Errorf("logs = %q, want the 4 statements", logger.logs)
+	}
+	// no transaction is begun for the DDL
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FaultRule defines which statements get a fault and what the fault is.
+// A statement matches when it matches all the set conditions, and the first matching rule applies.
+type FaultRule struct {
+	// Pattern is matched against the fingerprint, such as "select a from b where c = ?"
+	Pattern *regexp.Regexp
+	// Table matches the statements reading from or writing to it
+	Table string
+	// Probability is the chance a matching statement gets the fault, 0 means always
+	Probability float64
+	// From and Until bound the time window the rule is active in, zero means unbounded
+	From  time.Time
+	Until time.Time
+
+	// Latency is added before the statement is executed
+	Latency time.Duration
+	// Err is returned instead of executing the statement
+	Err error
+	// DropConn returns driver.ErrBadConn instead of executing the statement
+	DropConn bool
+	// PartialRows cuts the query result after so many rows, and the rows end with io.ErrUnexpectedEOF.
+	// Zero means not cut.
+	PartialRows int
+}
+
+func (r *FaultRule) match(now time.Time, fp string, tables []string) bool {
+	if !r.From.IsZero() && now.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !now.Before(r.Until) {
+		return false
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(fp) {
+		return false
+	}
+	if r.Table != "" {
+		found := false
+		for _, t := range tables {
+			if t == strings.ToLower(r.Table) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.Probability <= 0 || rand.Float64() < r.Probability
+}
+
+// FaultInjectionWrapper defines a fault injection wrapper for chaos testing
+// which injects latency, errors, dropped connections or partial results into the matching statements.
+// The rules can be replaced and the injection switched at runtime.
+type FaultInjectionWrapper struct {
+	enabled int32
+	rules   []FaultRule
+	sync.RWMutex
+}
+
+// NewFaultInjectionWrapper new an enabled fault injection wrapper with rules
+func NewFaultInjectionWrapper(rules ...FaultRule) *FaultInjectionWrapper {
+	return &FaultInjectionWrapper{
+		enabled: 1,
+		rules:   rules,
+	}
+}
+
+// SetRules replaces the rules
+func (w *FaultInjectionWrapper) SetRules(rules ...FaultRule) {
+	w.Lock()
+	defer w.Unlock()
+	w.rules = rules
+}
+
+// Enable switches the injection on
+func (w *FaultInjectionWrapper) Enable() {
+	atomic.StoreInt32(&w.enabled, 1)
+}
+
+// Disable switches the injection off, the statements go through untouched
+func (w *FaultInjectionWrapper) Disable() {
+	atomic.StoreInt32(&w.enabled, 0)
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *FaultInjectionWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		rule, err := w.inject(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := fn(ctx, query, args...)
+		if err != nil || rule == nil || rule.PartialRows <= 0 {
+			return rows, err
+		}
+		set, err := materializeRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		if rule.PartialRows < len(set.rows) {
+			set.rows = set.rows[:rule.PartialRows]
+		}
+		set.err = io.ErrUnexpectedEOF
+		return set.open(ctx)
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *FaultInjectionWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if _, err := w.inject(ctx, query); err != nil {
+			return nil, err
+		}
+		return fn(ctx, query, args...)
+	}
+}
+
+// inject applies the latency and the error of the first matching rule,
+// the rule is returned for the query result to be cut
+func (w *FaultInjectionWrapper) inject(ctx context.Context, query string) (*FaultRule, error) {
+	rule := w.match(query)
+	if rule == nil {
+		return nil, nil
+	}
+	if rule.Latency > 0 {
+		timer := time.NewTimer(rule.Latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	switch {
+	case rule.DropConn:
+		return nil, driver.ErrBadConn
+	case rule.Err != nil:
+		return nil, rule.Err
+	}
+	return rule, nil
+}
+
+func (w *FaultInjectionWrapper) match(query string) *FaultRule {
+	if atomic.LoadInt32(&w.enabled) == 0 {
+		return nil
+	}
+	w.RLock()
+	defer w.RUnlock()
+	if len(w.rules) == 0 {
+		return nil
+	}
+	now, fp, tables := time.Now(), fingerprint(query), statementTables(query)
+	for i := range w.rules {
+		if w.rules[i].match(now, fp, tables) {
+			rule := w.rules[i]
+			return &rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFaultInjectionWrapper_WrapExecContext(t *testing.T) {
+	injected := errors.New("injected")
+	wp := NewFaultInjectionWrapper(
+		FaultRule{Table: "orders", DropConn: true},
+		FaultRule{Pattern: regexp.MustCompile(`^update users`), Err: injected},
+		FaultRule{Table: "users", Until: time.Now().Add(-time.Minute), Err: injected},
+		FaultRule{Table: "logs", Latency: 10 * time.Millisecond},
+	)
+	fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		return sqlmock.NewResult(0, 1), nil
+	})
+	exec := wp.WrapExecContext(fn, "")
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr error
+	}{
+		{"TestFaultInjection_DropConn", "DELETE FROM orders WHERE id = 1", driver.ErrBadConn},
+		{"TestFaultInjection_Pattern", "UPDATE users SET a = 1 WHERE id = 1", injected},
+		{"TestFaultInjection_Expired", "DELETE FROM users WHERE id = 1", nil},
+		{"TestFaultInjection_NoMatch", "DELETE FROM items WHERE id = 1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec(context.TODO(), tt.query); !errors.Is(err, tt.wantErr) {
+				t.Errorf("exec() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	start := time.Now()
+	exec(context.TODO(), "DELETE FROM logs")
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("exec() took %v, want latency of 10ms", d)
+	}
+
+	wp.Disable()
+	if _, err := exec(context.TODO(), "DELETE FROM orders WHERE id = 1"); err != nil {
+		t.Errorf("exec() while disabled error = %v", err)
+	}
+}
+
+func TestFaultInjectionWrapper_PartialRows(t *testing.T) {
+	calls := 0
+	wp := NewFaultInjectionWrapper(FaultRule{Table: "countries", PartialRows: 1})
+	rows, err := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "")(context.TODO(), "SELECT id, name FROM countries")
+	if err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("rows = %d, want 1", n)
+	}
+	if !errors.Is(rows.Err(), io.ErrUnexpectedEOF) {
+		t.Errorf("rows.Err() = %v, want %v", rows.Err(), io.ErrUnexpectedEOF)
+	}
+}
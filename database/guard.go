@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	GuardRuleUnboundedWrite = "unbounded write"
+	GuardRuleDDL            = "ddl"
+	GuardRuleSelectStar     = "select star"
+	GuardRuleDenyList       = "deny list"
+)
+
+// GuardViolationError is returned without calling the database when a statement breaks the guard's policy
+type GuardViolationError struct {
+	Rule      string
+	Statement string
+}
+
+func (e *GuardViolationError) Error() string {
+	return fmt.Sprintf("database: statement blocked by guard rule %q: %s", e.Rule, e.Statement)
+}
+
+// QueryGuardWrapper defines a query guard wrapper
+// which checks the statements against its policy before they are executed
+type QueryGuardWrapper struct {
+	unboundedWrites  bool
+	ddl              bool
+	selectStarTables map[string]bool
+	denyList         []*regexp.Regexp
+	auditOnly        bool
+	logger           Logger
+}
+
+// QueryGuardOption defines the query guard wrapper's option
+type QueryGuardOption func(*QueryGuardWrapper)
+
+// WithGuardUnboundedWrites blocks UPDATE and DELETE statements without WHERE
+func WithGuardUnboundedWrites() QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		w.unboundedWrites = true
+	}
+}
+
+// WithGuardDDL blocks DROP and TRUNCATE statements
+func WithGuardDDL() QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		w.ddl = true
+	}
+}
+
+// WithGuardSelectStar blocks SELECT * on the given tables
+func WithGuardSelectStar(tables ...string) QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		for _, t := range tables {
+			w.selectStarTables[strings.ToLower(t)] = true
+		}
+	}
+}
+
+// WithGuardDenyList blocks the statements whose fingerprint matches any of patterns.
+// The fingerprint is lower cased with the literals replaced by ?, such as "select a from b where c = ?".
+func WithGuardDenyList(patterns ...*regexp.Regexp) QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		w.denyList = append(w.denyList, patterns...)
+	}
+}
+
+// WithGuardAuditOnly lets the violating statements through, they are only logged and tagged on the span
+func WithGuardAuditOnly() QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		w.auditOnly = true
+	}
+}
+
+// WithGuardLogger logs the violations to l
+func WithGuardLogger(l Logger) QueryGuardOption {
+	return func(w *QueryGuardWrapper) {
+		w.logger = l
+	}
+}
+
+// NewQueryGuardWrapper new a query guard wrapper, it blocks nothing until rules are added by options
+func NewQueryGuardWrapper(options ...QueryGuardOption) *QueryGuardWrapper {
+	w := &QueryGuardWrapper{
+		selectStarTables: make(map[string]bool),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *QueryGuardWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		if err := w.guard(ctx, query); err != nil {
+			return nil, err
+		}
+		return fn(ctx, query, args...)
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *QueryGuardWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if err := w.guard(ctx, query); err != nil {
+			return nil, err
+		}
+		return fn(ctx, query, args...)
+	}
+}
+
+// guard reports the violation of query, the error is nil in audit-only mode
+func (w *QueryGuardWrapper) guard(ctx context.Context, query string) error {
+	rule := w.check(query)
+	if rule == "" {
+		return nil
+	}
+	err := &GuardViolationError{Rule: rule, Statement: fingerprint(query)}
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag("db.guard.violation", rule)
+		if !w.auditOnly {
+			tags.Error.Set(span, true)
+		}
+	}
+	if w.logger != nil {
+		w.logger.Log(os.Stderr, fmt.Sprintf("query guard: %s\n", err))
+	}
+	if w.auditOnly {
+		return nil
+	}
+	return err
+}
+
+// check returns the first rule query breaks, or "" if none.
+// Every statement of a multi-statement query is checked, such as the DROP of "SELECT 1; DROP TABLE users".
+func (w *QueryGuardWrapper) check(query string) string {
+	statements := splitStatements(query)
+	if len(statements) == 0 {
+		return w.checkStatement(query)
+	}
+	for _, statement := range statements {
+		if rule := w.checkStatement(statement); rule != "" {
+			return rule
+		}
+	}
+	return ""
+}
+
+// checkStatement returns the first rule a single statement breaks, or "" if none
+func (w *QueryGuardWrapper) checkStatement(query string) string {
+	verb := statementVerb(query)
+	if w.unboundedWrites && (verb == "UPDATE" || verb == "DELETE") && !hasWhereClause(query) {
+		return GuardRuleUnboundedWrite
+	}
+	if w.ddl && (verb == "DROP" || verb == "TRUNCATE") {
+		return GuardRuleDDL
+	}
+	if len(w.selectStarTables) > 0 && hasSelectStar(query) {
+		for _, t := range statementTables(query) {
+			if w.selectStarTables[t] {
+				return GuardRuleSelectStar
+			}
+		}
+	}
+	if len(w.denyList) > 0 {
+		fp := fingerprint(query)
+		for _, p := range w.denyList {
+			if p.MatchString(fp) {
+				return GuardRuleDenyList
+			}
+		}
+	}
+	return ""
+}
+
+// hasSelectStar reports whether query selects * or t.*, the * in count(*) or a * b does not count
+func hasSelectStar(query string) bool {
+	tokens := tokenize(query)
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].text != "*" {
+			continue
+		}
+		switch prev := tokens[i-1]; {
+		case prev.text == "." || prev.text == ",":
+			return true
+		case prev.upper() == "SELECT" || prev.upper() == "DISTINCT" || prev.upper() == "ALL":
+			return true
+		}
+	}
+	return false
+}
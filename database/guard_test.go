@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestQueryGuardWrapper_check(t *testing.T) {
+	wp := NewQueryGuardWrapper(
+		WithGuardUnboundedWrites(),
+		WithGuardDDL(),
+		WithGuardSelectStar("users"),
+		WithGuardDenyList(regexp.MustCompile(`sleep\(`)),
+	)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"UPDATE users SET name = ?", GuardRuleUnboundedWrite},
+		{"UPDATE users SET name = ? WHERE id = ?", ""},
+		{"DELETE FROM users", GuardRuleUnboundedWrite},
+		{"DELETE FROM users WHERE id IN (SELECT id FROM bans)", ""},
+		{"DROP TABLE users", GuardRuleDDL},
+		{"TRUNCATE TABLE users", GuardRuleDDL},
+		{"SELECT * FROM users WHERE id = ?", GuardRuleSelectStar},
+		{"SELECT u.* FROM users u JOIN orders o ON o.user_id = u.id", GuardRuleSelectStar},
+		{"SELECT * FROM orders", ""},
+		{"SELECT count(*) FROM users", ""},
+		{"SELECT a * b FROM users", ""},
+		{"SELECT SLEEP(10)", GuardRuleDenyList},
+		{"SELECT 1; DROP TABLE users", GuardRuleDDL},
+		{"SELECT 1; DELETE FROM users", GuardRuleUnboundedWrite},
+		{"SELECT ';' FROM orders; UPDATE orders SET a = 1 WHERE id = 1;", ""},
+	}
+	for _, tt := range tests {
+		if got := wp.check(tt.query); got != tt.want {
+			t.Errorf("check(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryGuardWrapper_WrapExecContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		wp        *QueryGuardWrapper
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "TestQueryGuardWrapper_WrapExecContext_Block",
+			wp:        NewQueryGuardWrapper(WithGuardUnboundedWrites()),
+			wantCalls: 0,
+			wantErr:   true,
+		},
+		{
+			name:      "TestQueryGuardWrapper_WrapExecContext_AuditOnly",
+			wp:        NewQueryGuardWrapper(WithGuardUnboundedWrites(), WithGuardAuditOnly(), WithGuardLogger(&transitionLogger{})),
+			wantCalls: 1,
+			wantErr:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+				calls++
+				return sqlmock.NewResult(0, 1), nil
+			})
+			span := opentracing.GlobalTracer().StartSpan("x")
+			ctx := opentracing.ContextWithSpan(context.TODO(), span)
+			_, err := tt.wp.WrapExecContext(fn, "DELETE FROM users")(ctx, "DELETE FROM users")
+			var violation *GuardViolationError
+			if errors.As(err, &violation) != tt.wantErr {
+				t.Errorf("WrapExecContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if got := span.(*mocktracer.MockSpan).Tag("db.guard.violation"); got != GuardRuleUnboundedWrite {
+				t.Errorf("db.guard.violation = %v, want %v", got, GuardRuleUnboundedWrite)
+			}
+		})
+	}
+}
@@ -3,30 +3,32 @@ package database
 import (
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/event"
 )
 
+// NewMongoQueryTracer new a tracer wrapper of the mongo type.
+//
+// Deprecated: the mongo operations don't go through the wrapped funcs, use NewMongoCommandTracer to trace them.
 func NewMongoQueryTracer(options ...TracerOption) *TracerWrapper {
 	return newTracerWrapperWithTracer(newTracer("mongo", options...))
 }
 
-func NewMongoPoolMonitor(t MonitorType) Monitor {
-	switch t {
-	case StatsD:
-		return &StatsDPoolMonitor{
-			prefix: "database.mongo",
-		}
-	case Prometheus:
-		return &PrometheusPoolMonitor{
-			prefix: "database.mongo",
-		}
-	default:
-		return &DefaultPoolMonitor{}
-	}
+// NewMongoPoolMonitor new a pool monitor of the mongo pools, see NewPoolMonitor for the options
+func NewMongoPoolMonitor(t MonitorType, options ...PoolMonitorOption) (Monitor, error) {
+	return NewPoolMonitor("mongo", t, options...)
 }
 
+// NewMongoDriverMonitor new a mongo driver pool monitor reporting the pool events to m,
+// with the server address if m is an AddressMonitor, and the checkout waits if m is a CheckoutWaitMonitor.
+// The checkout waits are measured from GetStarted to GetSucceeded or GetFailed of the same address,
+// the concurrent checkouts of an address are assumed to finish in the order they started.
 func NewMongoDriverMonitor(m Monitor) *event.PoolMonitor {
+	wm, _ := m.(CheckoutWaitMonitor)
+	timer := newCheckoutTimer()
+	r := newAddressReporter(m)
 	return &event.PoolMonitor{
 		Event: func(evt *event.PoolEvent) {
 			if os.Getenv(DEBUG_ENV) != "" {
@@ -34,30 +36,168 @@ func NewMongoDriverMonitor(m Monitor) *event.PoolMonitor {
 			}
 			switch evt.Type {
 			case event.PoolCreated:
-				if err := m.Pool(PoolCreate); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				if err := r.pool(evt.Address, PoolCreate); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("pool: %s\n", err))
 				}
 			case event.PoolCleared:
-				if err := m.Pool(PoolClear); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				if err := r.pool(evt.Address, PoolClear); err != nil && os.Getenv(DEBUG_ENV) != "" {
+					m.Log(os.Stderr, fmt.Sprintf("pool: %s\n", err))
+				}
+			case event.PoolClosedEvent:
+				timer.reset(evt.Address)
+				if err := r.pool(evt.Address, PoolClose); err != nil && os.Getenv(DEBUG_ENV) != "" {
+					m.Log(os.Stderr, fmt.Sprintf("pool: %s\n", err))
+				}
+				// the pool of a server is closed when it leaves the topology
+				if err := r.removeAddress(evt.Address); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("pool: %s\n", err))
 				}
 			case event.ConnectionCreated:
-				if err := m.Conn(ConnCreate); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				if err := r.conn(evt.Address, ConnCreate); err != nil && os.Getenv(DEBUG_ENV) != "" {
+					m.Log(os.Stderr, fmt.Sprintf("conn: %s\n", err))
+				}
+			case event.ConnectionReady:
+				if err := r.conn(evt.Address, ConnReady); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("conn: %s\n", err))
 				}
 			case event.ConnectionClosed:
-				if err := m.Conn(ConnClose); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				if err := r.conn(evt.Address, ConnClose); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("conn: %s\n", err))
 				}
 			case event.ConnectionReturned:
-				if err := m.Conn(ConnRelease); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				if err := r.conn(evt.Address, ConnRelease); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("conn: %s\n", err))
 				}
 			case event.GetSucceeded:
-				if err := m.Conn(Connoccupy); err != nil && os.Getenv(DEBUG_ENV) != "" {
+				reportCheckoutWait(wm, timer, evt.Address)
+				if err := r.conn(evt.Address, Connoccupy); err != nil && os.Getenv(DEBUG_ENV) != "" {
 					m.Log(os.Stderr, fmt.Sprintf("conn: %s\n", err))
 				}
+			case event.GetStarted:
+				if wm != nil {
+					timer.start(evt.Address)
+				}
+				if err := r.checkout(evt.Address, CheckoutStart); err != nil && os.Getenv(DEBUG_ENV) != "" {
+					m.Log(os.Stderr, fmt.Sprintf("checkout: %s\n", err))
+				}
+			case event.GetFailed:
+				reportCheckoutWait(wm, timer, evt.Address)
+				if err := r.checkout(evt.Address, checkoutFailure(evt.Reason)); err != nil && os.Getenv(DEBUG_ENV) != "" {
+					m.Log(os.Stderr, fmt.Sprintf("checkout: %s\n", err))
+				}
 			}
 		},
 	}
 }
+
+// checkoutFailure maps the reason of a GetFailed event to the checkout operation
+func checkoutFailure(reason string) CheckoutOperation {
+	switch reason {
+	case event.ReasonTimedOut:
+		return CheckoutTimeout
+	case event.ReasonPoolClosed:
+		return CheckoutPoolClosed
+	default:
+		return CheckoutConnError
+	}
+}
+
+// maxPendingCheckouts bounds the started checkouts kept per address, in case the finishing events are missed
+const maxPendingCheckouts = 1024
+
+// checkoutTimer keeps the start time of the pending checkouts per address,
+// a finished checkout takes the earliest one as the events do not identify the checkouts
+type checkoutTimer struct {
+	started map[string][]time.Time
+	sync.Mutex
+}
+
+func newCheckoutTimer() *checkoutTimer {
+	return &checkoutTimer{
+		started: make(map[string][]time.Time),
+	}
+}
+
+func (t *checkoutTimer) start(address string) {
+	t.Lock()
+	defer t.Unlock()
+	q := t.started[address]
+	if len(q) >= maxPendingCheckouts {
+		q = q[1:]
+	}
+	t.started[address] = append(q, time.Now())
+}
+
+// finish returns how long the earliest pending checkout of address waited, false if there is none
+func (t *checkoutTimer) finish(address string) (time.Duration, bool) {
+	t.Lock()
+	defer t.Unlock()
+	q := t.started[address]
+	if len(q) == 0 {
+		return 0, false
+	}
+	if len(q) == 1 {
+		delete(t.started, address)
+	} else {
+		t.started[address] = q[1:]
+	}
+	return time.Since(q[0]), true
+}
+
+func (t *checkoutTimer) reset(address string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.started, address)
+}
+
+func reportCheckoutWait(m CheckoutWaitMonitor, timer *checkoutTimer, address string) {
+	if m == nil {
+		return
+	}
+	d, ok := timer.finish(address)
+	if !ok {
+		return
+	}
+	if err := m.CheckoutWait(address, d); err != nil && os.Getenv(DEBUG_ENV) != "" {
+		m.Log(os.Stderr, fmt.Sprintf("checkout: %s\n", err))
+	}
+}
+
+// addressReporter reports the pool events with their address if the monitor is an AddressMonitor
+type addressReporter struct {
+	m  Monitor
+	am AddressMonitor
+}
+
+func newAddressReporter(m Monitor) addressReporter {
+	am, _ := m.(AddressMonitor)
+	return addressReporter{m: m, am: am}
+}
+
+func (r addressReporter) pool(address string, op PoolOperation) error {
+	if r.am != nil {
+		return r.am.PoolAt(address, op)
+	}
+	return r.m.Pool(op)
+}
+
+func (r addressReporter) conn(address string, op ConnOperation) error {
+	if r.am != nil {
+		return r.am.ConnAt(address, op)
+	}
+	return r.m.Conn(op)
+}
+
+func (r addressReporter) checkout(address string, op CheckoutOperation) error {
+	if r.am != nil {
+		return r.am.CheckoutAt(address, op)
+	}
+	return r.m.Checkout(op)
+}
+
+func (r addressReporter) removeAddress(address string) error {
+	if r.am != nil {
+		return r.am.RemoveAddress(address)
+	}
+	return nil
+}
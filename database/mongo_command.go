@@ -0,0 +1,193 @@
+package database
+
+import (
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+const (
+	defaultMongoCommandSize = 4096
+	mongoPlaceholder        = "?"
+	mongoRedacted           = "<redacted>"
+)
+
+var (
+	// MongoRawCommandOption enable the raw command option of the mongo command tracer
+	// raw command option will render the real values instead of the placeholders.
+	// Once enabled, {"find": "users", "filter": {"age": 18}} will be {"find":"users","filter":{"age":18}}
+	// instead of {"find":"users","filter":{"age":"?"}}
+	MongoRawCommandOption = mongoRawCommandOption{}
+)
+
+// mongoSessionFields are added by the driver and differ on every command, they are never rendered
+var mongoSessionFields = map[string]bool{
+	"lsid":         true,
+	"$clusterTime": true,
+	"txnNumber":    true,
+	"$db":          true,
+}
+
+// mongoCommandOption is a TracerOption used by the mongo command tracer,
+// the other options are for the SQL statements and ignored by it
+type mongoCommandOption interface {
+	TracerOption
+	apply(*mongoCommandRenderer)
+}
+
+type mongoRawCommandOption struct{}
+
+func (opt mongoRawCommandOption) QueryBuilder() func(query string, args ...interface{}) string {
+	return keepQueryBuilder
+}
+
+func (opt mongoRawCommandOption) apply(r *mongoCommandRenderer) {
+	r.raw = true
+}
+
+type mongoRedactFieldsOption []string
+
+// MongoRedactFieldsOption replaces the values of the fields at any depth with "<redacted>",
+// so that they are never rendered even with MongoRawCommandOption
+func MongoRedactFieldsOption(fields ...string) TracerOption {
+	return mongoRedactFieldsOption(fields)
+}
+
+func (opt mongoRedactFieldsOption) QueryBuilder() func(query string, args ...interface{}) string {
+	return keepQueryBuilder
+}
+
+func (opt mongoRedactFieldsOption) apply(r *mongoCommandRenderer) {
+	for _, field := range opt {
+		r.redact[field] = true
+	}
+}
+
+type mongoMaxCommandSizeOption int
+
+// MongoMaxCommandSizeOption caps the rendered commands to n bytes, 4KiB by default
+func MongoMaxCommandSizeOption(n int) TracerOption {
+	return mongoMaxCommandSizeOption(n)
+}
+
+func (opt mongoMaxCommandSizeOption) QueryBuilder() func(query string, args ...interface{}) string {
+	return keepQueryBuilder
+}
+
+func (opt mongoMaxCommandSizeOption) apply(r *mongoCommandRenderer) {
+	if opt > 0 {
+		r.maxSize = int(opt)
+	}
+}
+
+// apply maps RawQueryOption to MongoRawCommandOption for the mongo command tracer
+func (opt rawQueryOption) apply(r *mongoCommandRenderer) {
+	r.raw = true
+}
+
+func keepQueryBuilder(query string, _ ...interface{}) string {
+	return query
+}
+
+// mongoCommandRenderer renders the command documents as relaxed extended JSON.
+// By default the values are replaced by placeholders, so that the same queries have the same shape:
+// {"find": "users", "filter": {"age": {"$in": [18, 19]}}} will be {"find":"users","filter":{"age":{"$in":["?"]}}}
+type mongoCommandRenderer struct {
+	raw     bool
+	redact  map[string]bool
+	maxSize int
+}
+
+func newMongoCommandRenderer(options ...TracerOption) *mongoCommandRenderer {
+	r := &mongoCommandRenderer{
+		redact:  make(map[string]bool),
+		maxSize: defaultMongoCommandSize,
+	}
+	for _, op := range options {
+		if mo, ok := op.(mongoCommandOption); ok {
+			mo.apply(r)
+		}
+	}
+	return r
+}
+
+func (r *mongoCommandRenderer) render(command bson.Raw) string {
+	elems, err := command.Elements()
+	if err != nil {
+		return ""
+	}
+	doc := make(bson.D, 0, len(elems))
+	for i, elem := range elems {
+		key, v := elem.Key(), elem.Value()
+		switch {
+		case mongoSessionFields[key]:
+			continue
+		case i == 0 && v.Type == bsontype.String && !r.redact[key]:
+			// the value of the command name is the collection, which is a part of the shape
+			doc = append(doc, bson.E{Key: key, Value: v.StringValue()})
+		default:
+			doc = append(doc, bson.E{Key: key, Value: r.value(key, v)})
+		}
+	}
+	b, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// value renders the value of the field key
+func (r *mongoCommandRenderer) value(key string, v bson.RawValue) interface{} {
+	if r.redact[key] {
+		return mongoRedacted
+	}
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		elems, _ := v.Document().Elements()
+		doc := make(bson.D, 0, len(elems))
+		for _, elem := range elems {
+			doc = append(doc, bson.E{Key: elem.Key(), Value: r.value(elem.Key(), elem.Value())})
+		}
+		return doc
+	case bsontype.Array:
+		values, _ := v.Array().Values()
+		return r.array(values)
+	default:
+		if r.raw {
+			return v
+		}
+		return mongoPlaceholder
+	}
+}
+
+// array renders the array values, the shapes repeated in a row are collapsed to one if the values are not raw,
+// such as the documents of an insert or the values of an $in
+func (r *mongoCommandRenderer) array(values []bson.RawValue) bson.A {
+	a := make(bson.A, 0, len(values))
+	last := ""
+	for _, v := range values {
+		rendered := r.value("", v)
+		if !r.raw {
+			b, err := bson.MarshalExtJSON(bson.D{{Key: "", Value: rendered}}, false, false)
+			if err == nil && string(b) == last {
+				continue
+			}
+			last = string(b)
+		}
+		a = append(a, rendered)
+	}
+	return a
+}
+
+// truncate caps the rendered command to the max size
+func (r *mongoCommandRenderer) truncate(s string) string {
+	if len(s) <= r.maxSize {
+		return s
+	}
+	n := r.maxSize
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
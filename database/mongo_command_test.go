@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoCommandRenderer(t *testing.T) {
+	find := bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{
+			{Key: "age", Value: bson.D{{Key: "$in", Value: bson.A{18, 19, 20}}}},
+			{Key: "password", Value: "secret"},
+		}},
+		{Key: "limit", Value: 10},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: "session"}}},
+		{Key: "$db", Value: "app"},
+	}
+	insert := bson.D{
+		{Key: "insert", Value: "users"},
+		{Key: "documents", Value: bson.A{
+			bson.D{{Key: "name", Value: "a"}},
+			bson.D{{Key: "name", Value: "b"}},
+			bson.D{{Key: "name", Value: "c"}, {Key: "age", Value: 1}},
+		}},
+	}
+	tests := []struct {
+		name    string
+		command bson.D
+		options []TracerOption
+		want    string
+	}{
+		{
+			name:    "TestMongoCommandRenderer_Shape",
+			command: find,
+			want:    `{"find":"users","filter":{"age":{"$in":["?"]},"password":"?"},"limit":"?"}`,
+		},
+		{
+			name:    "TestMongoCommandRenderer_Documents",
+			command: insert,
+			want:    `{"insert":"users","documents":[{"name":"?"},{"name":"?","age":"?"}]}`,
+		},
+		{
+			name:    "TestMongoCommandRenderer_Raw",
+			command: find,
+			options: []TracerOption{MongoRawCommandOption},
+			want:    `{"find":"users","filter":{"age":{"$in":[18,19,20]},"password":"secret"},"limit":10}`,
+		},
+		{
+			name:    "TestMongoCommandRenderer_Redact",
+			command: find,
+			options: []TracerOption{MongoRawCommandOption, MongoRedactFieldsOption("password")},
+			want:    `{"find":"users","filter":{"age":{"$in":[18,19,20]},"password":"<redacted>"},"limit":10}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(tt.command)
+			if err != nil {
+				t.Fatalf("bson.Marshal() error = %v", err)
+			}
+			if got := newMongoCommandRenderer(tt.options...).render(raw); got != tt.want {
+				t.Errorf("render() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoCommandRenderer_truncate(t *testing.T) {
+	r := newMongoCommandRenderer(MongoMaxCommandSizeOption(5))
+	if got := r.truncate("abcdefg"); got != "abcde..." {
+		t.Errorf("truncate() = %q, want %q", got, "abcde...")
+	}
+	if got := r.truncate("abcd世界"); got != "abcd..." {
+		t.Errorf("truncate() = %q, want the runes kept whole", got)
+	}
+	if got := newMongoCommandRenderer().truncate(strings.Repeat("a", 100)); len(got) != 100 {
+		t.Errorf("truncate() len = %d, want 100 under the default size", len(got))
+	}
+}
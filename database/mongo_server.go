@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// NewMongoServerMonitor new a mongo driver server monitor reporting the heartbeats,
+// the server description changes and the topology changes (primary elections) to m.
+// The changes are logged with m when DEBUG_ENV is set, and reported as metrics if m is a TopologyMonitor.
+// The awaited heartbeats of the streaming protocol wait for the server's changes, their durations are not reported.
+func NewMongoServerMonitor(m Monitor) *event.ServerMonitor {
+	tm, _ := m.(TopologyMonitor)
+	log := func(w io.Writer, msg string) {
+		if os.Getenv(DEBUG_ENV) != "" {
+			m.Log(w, msg)
+		}
+	}
+	server := func(address string, op ServerOperation) {
+		if tm == nil {
+			return
+		}
+		if err := tm.Server(address, op); err != nil {
+			log(os.Stderr, fmt.Sprintf("server: %s\n", err))
+		}
+	}
+	heartbeat := func(connectionID string, d time.Duration, err error) {
+		if tm == nil {
+			return
+		}
+		if err := tm.Heartbeat(mongoAddress(connectionID), d, err); err != nil {
+			log(os.Stderr, fmt.Sprintf("heartbeat: %s\n", err))
+		}
+	}
+	return &event.ServerMonitor{
+		ServerOpening: func(evt *event.ServerOpeningEvent) {
+			log(os.Stdout, fmt.Sprintf("server: %s opening\n", evt.Address))
+			server(evt.Address.String(), ServerOpen)
+		},
+		ServerClosed: func(evt *event.ServerClosedEvent) {
+			log(os.Stdout, fmt.Sprintf("server: %s closed\n", evt.Address))
+			server(evt.Address.String(), ServerClose)
+		},
+		ServerDescriptionChanged: func(evt *event.ServerDescriptionChangedEvent) {
+			if evt.PreviousDescription.Kind == evt.NewDescription.Kind {
+				return
+			}
+			log(os.Stdout, fmt.Sprintf("server: %s %s -> %s\n", evt.Address, evt.PreviousDescription.Kind, evt.NewDescription.Kind))
+			server(evt.Address.String(), ServerDescriptionChange)
+		},
+		TopologyDescriptionChanged: func(evt *event.TopologyDescriptionChangedEvent) {
+			previous, primary := mongoPrimary(evt.PreviousDescription), mongoPrimary(evt.NewDescription)
+			if previous == primary {
+				return
+			}
+			log(os.Stdout, fmt.Sprintf("topology: primary %q -> %q\n", previous, primary))
+			server(primary, PrimaryChange)
+		},
+		ServerHeartbeatSucceeded: func(evt *event.ServerHeartbeatSucceededEvent) {
+			if !evt.Awaited {
+				heartbeat(evt.ConnectionID, time.Duration(evt.DurationNanos), nil)
+			}
+		},
+		ServerHeartbeatFailed: func(evt *event.ServerHeartbeatFailedEvent) {
+			err := evt.Failure
+			if err == nil {
+				err = errors.New("heartbeat failed")
+			}
+			log(os.Stderr, fmt.Sprintf("heartbeat: %s: %s\n", mongoAddress(evt.ConnectionID), err))
+			heartbeat(evt.ConnectionID, time.Duration(evt.DurationNanos), err)
+		},
+	}
+}
+
+// mongoPrimary returns the address of the topology's primary, "" if it has none
+func mongoPrimary(t description.Topology) string {
+	for _, s := range t.Servers {
+		if s.Kind == description.RSPrimary {
+			return s.Addr.String()
+		}
+	}
+	return ""
+}
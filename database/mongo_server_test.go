@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// topologyRecorder records the server operations and the heartbeats on top of the default monitor
+type topologyRecorder struct {
+	DefaultPoolMonitor
+	logs       []string
+	servers    []string
+	heartbeats []time.Duration
+	failures   int
+}
+
+func (r *topologyRecorder) Log(_ io.Writer, a any) {
+	r.logs = append(r.logs, fmt.Sprint(a))
+}
+
+func (r *topologyRecorder) Heartbeat(address string, d time.Duration, err error) error {
+	if err != nil {
+		r.failures++
+		return nil
+	}
+	r.heartbeats = append(r.heartbeats, d)
+	return nil
+}
+
+func (r *topologyRecorder) Server(address string, op ServerOperation) error {
+	r.servers = append(r.servers, op.name()+" "+address)
+	return nil
+}
+
+func TestNewMongoServerMonitor(t *testing.T) {
+	t.Setenv(DEBUG_ENV, "1")
+	r := &topologyRecorder{}
+	sm := NewMongoServerMonitor(r)
+	a, b := address.Address("a:27017"), address.Address("b:27017")
+	topology := func(primary address.Address) description.Topology {
+		servers := []description.Server{{Addr: a, Kind: description.RSSecondary}, {Addr: b, Kind: description.RSSecondary}}
+		for i := range servers {
+			if servers[i].Addr == primary {
+				servers[i].Kind = description.RSPrimary
+			}
+		}
+		return description.Topology{Servers: servers}
+	}
+
+	sm.ServerOpening(&event.ServerOpeningEvent{Address: a})
+	sm.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address: a, PreviousDescription: description.Server{Kind: description.RSSecondary}, NewDescription: description.Server{Kind: description.RSSecondary},
+	})
+	sm.ServerDescriptionChanged(&event.ServerDescriptionChangedEvent{
+		Address: b, PreviousDescription: description.Server{Kind: description.RSSecondary}, NewDescription: description.Server{Kind: description.RSPrimary},
+	})
+	sm.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{PreviousDescription: topology(a), NewDescription: topology(a)})
+	sm.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{PreviousDescription: topology(a), NewDescription: topology(b)})
+	sm.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{DurationNanos: int64(time.Millisecond), ConnectionID: "a:27017[-1]"})
+	sm.ServerHeartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{DurationNanos: int64(10 * time.Second), ConnectionID: "a:27017[-1]", Awaited: true})
+	sm.ServerHeartbeatFailed(&event.ServerHeartbeatFailedEvent{Failure: errors.New("connection refused"), ConnectionID: "b:27017[-2]"})
+	sm.ServerClosed(&event.ServerClosedEvent{Address: a})
+
+	wantServers := []string{"open a:27017", "description_changed b:27017", "primary_changed b:27017", "close a:27017"}
+	if fmt.Sprint(r.servers) != fmt.Sprint(wantServers) {
+		t.Errorf("servers = %q, want %q", r.servers, wantServers)
+	}
+	if len(r.heartbeats) != 1 || r.heartbeats[0] != time.Millisecond || r.failures != 1 {
+		t.Errorf("heartbeats = %v, failures = %d, want [1ms] and 1", r.heartbeats, r.failures)
+	}
+	wantLogs := []string{
+		"server: a:27017 opening\n",
+		"server: b:27017 RSSecondary -> RSPrimary\n",
+		"topology: primary \"a:27017\" -> \"b:27017\"\n",
+		"heartbeat: b:27017: connection refused\n",
+		"server: a:27017 closed\n",
+	}
+	if fmt.Sprint(r.logs) != fmt.Sprint(wantLogs) {
+		t.Errorf("logs = %q, want %q", r.logs, wantLogs)
+	}
+}
+
+func TestNewMongoServerMonitor_Log(t *testing.T) {
+	t.Setenv(DEBUG_ENV, "")
+	r := &topologyRecorder{}
+	sm := NewMongoServerMonitor(r)
+	sm.ServerOpening(&event.ServerOpeningEvent{Address: "a:27017"})
+	sm.ServerHeartbeatFailed(&event.ServerHeartbeatFailedEvent{Failure: errors.New("connection refused"), ConnectionID: "a:27017[-1]"})
+	sm.ServerClosed(&event.ServerClosedEvent{Address: "a:27017"})
+
+	if len(r.logs) != 0 {
+		t.Errorf("logs without %s = %q, want none", DEBUG_ENV, r.logs)
+	}
+	if len(r.servers) != 2 || r.failures != 1 {
+		t.Errorf("servers = %q, failures = %d, want 2 and 1", r.servers, r.failures)
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestNewMongoDriverMonitor(t *testing.T) {
+	m := &DefaultPoolMonitor{}
+	pm := NewMongoDriverMonitor(m)
+	for _, evt := range []*event.PoolEvent{
+		{Type: event.PoolCreated},
+		{Type: event.ConnectionCreated},
+		{Type: event.ConnectionReady},
+		{Type: event.GetStarted},
+		{Type: event.GetSucceeded},
+		{Type: event.GetStarted},
+		{Type: event.GetFailed, Reason: event.ReasonTimedOut},
+		{Type: event.GetStarted},
+		{Type: event.GetFailed, Reason: event.ReasonConnectionErrored},
+		{Type: event.PoolClosedEvent},
+	} {
+		pm.Event(evt)
+	}
+
+	if m.poolSize != 1 || m.poolClosed != 1 || m.connNum != 1 || m.occupyNum != 1 || m.readyNum != 1 {
+		t.Errorf("pools = %d, closed = %d, conns = %d, occupied = %d, ready = %d, want all 1",
+			m.poolSize, m.poolClosed, m.connNum, m.occupyNum, m.readyNum)
+	}
+	want := map[CheckoutOperation]int64{CheckoutStart: 3, CheckoutTimeout: 1, CheckoutConnError: 1}
+	for op, n := range want {
+		if m.checkouts[op] != n {
+			t.Errorf("checkouts[%d] = %d, want %d", op, m.checkouts[op], n)
+		}
+	}
+	if m.checkouts[CheckoutPoolClosed] != 0 {
+		t.Errorf("checkouts[CheckoutPoolClosed] = %d, want 0", m.checkouts[CheckoutPoolClosed])
+	}
+}
+
+func TestNewMongoDriverMonitor_CheckoutWait(t *testing.T) {
+	m := &DefaultPoolMonitor{}
+	pm := NewMongoDriverMonitor(m)
+	pm.Event(&event.PoolEvent{Type: event.GetStarted, Address: "a:27017"})
+	pm.Event(&event.PoolEvent{Type: event.GetStarted, Address: "b:27017"})
+	time.Sleep(10 * time.Millisecond)
+	pm.Event(&event.PoolEvent{Type: event.GetStarted, Address: "a:27017"})
+	pm.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: "a:27017"})
+	pm.Event(&event.PoolEvent{Type: event.GetFailed, Address: "a:27017", Reason: event.ReasonTimedOut})
+	pm.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: "b:27017"})
+	// no pending checkout to correlate with
+	pm.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: "b:27017"})
+
+	a, b := m.waits["a:27017"], m.waits["b:27017"]
+	if a == nil || a.count != 2 || a.max < 10*time.Millisecond {
+		t.Errorf("waits of a = %+v, want 2 waits of 10ms at most", a)
+	}
+	if b == nil || b.count != 1 || b.max < 10*time.Millisecond {
+		t.Errorf("waits of b = %+v, want 1 wait of 10ms", b)
+	}
+}
+
+// basicMonitor only implements Monitor, hiding the optional interfaces of the embedded one
+type basicMonitor struct {
+	Monitor
+}
+
+func TestNewMongoDriverMonitor_NoCheckoutWait(t *testing.T) {
+	m := &DefaultPoolMonitor{}
+	pm := NewMongoDriverMonitor(basicMonitor{m})
+	for _, typ := range []string{event.GetStarted, event.GetSucceeded} {
+		pm.Event(&event.PoolEvent{Type: typ, Address: "a:27017"})
+	}
+	if m.checkouts[CheckoutStart] != 1 || m.waits != nil {
+		t.Errorf("checkouts = %v, waits = %v, want the checkout without its wait", m.checkouts, m.waits)
+	}
+}
+
+func TestNewMongoDriverMonitor_Address(t *testing.T) {
+	m := &DefaultPoolMonitor{}
+	pm := NewMongoDriverMonitor(m)
+	for _, address := range []string{"a:27017", "b:27017"} {
+		for _, typ := range []string{event.PoolCreated, event.ConnectionCreated, event.ConnectionCreated, event.GetSucceeded} {
+			pm.Event(&event.PoolEvent{Type: typ, Address: address})
+		}
+	}
+	if a := m.addresses["a:27017"]; a == nil || *a != (addressStats{pools: 1, conns: 2, occupied: 1}) {
+		t.Errorf("state of a = %+v, want 1 pool, 2 conns and 1 occupied", a)
+	}
+
+	// b leaves the topology with a connection still occupied
+	pm.Event(&event.PoolEvent{Type: event.ConnectionClosed, Address: "b:27017"})
+	pm.Event(&event.PoolEvent{Type: event.PoolClosedEvent, Address: "b:27017"})
+	if _, ok := m.addresses["b:27017"]; ok {
+		t.Errorf("state of b is not removed")
+	}
+	if m.poolSize != 1 || m.connNum != 2 || m.occupyNum != 1 {
+		t.Errorf("pools = %d, conns = %d, occupied = %d, want the state of a", m.poolSize, m.connNum, m.occupyNum)
+	}
+}
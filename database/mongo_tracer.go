@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// mongoCommandKey identifies a command in flight, the request IDs are only unique on a connection
+type mongoCommandKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// mongoCommandTracer traces the mongo commands,
+// a span is started on every started command and finished when it succeeds or fails
+type mongoCommandTracer struct {
+	renderer *mongoCommandRenderer
+	spans    map[mongoCommandKey]opentracing.Span
+	sync.Mutex
+}
+
+// NewMongoCommandTracer new a mongo command tracer, the command documents are rendered as extended JSON shapes
+// as the statements, see MongoRawCommandOption, MongoRedactFieldsOption and MongoMaxCommandSizeOption.
+// RawQueryOption is the same as MongoRawCommandOption, the other options of the SQL statements are ignored.
+// Set the returned CommandMonitor to the client options with SetMonitor.
+func NewMongoCommandTracer(options ...TracerOption) *event.CommandMonitor {
+	t := &mongoCommandTracer{
+		renderer: newMongoCommandRenderer(options...),
+		spans:    make(map[mongoCommandKey]opentracing.Span),
+	}
+	return t.commandMonitor()
+}
+
+// commandMonitor returns the driver's command monitor of t
+func (t *mongoCommandTracer) commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   t.started,
+		Succeeded: t.succeeded,
+		Failed:    t.failed,
+	}
+}
+
+func (t *mongoCommandTracer) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := opentracing.GlobalTracer().StartSpan("mongo", opts...)
+	tags.DBType.Set(span, "mongo")
+	tags.DBInstance.Set(span, evt.DatabaseName)
+	tags.DBStatement.Set(span, t.statement(evt.Command))
+	tags.PeerAddress.Set(span, mongoAddress(evt.ConnectionID))
+	span.SetTag("db.mongo.command", evt.CommandName)
+	if collection := mongoCollection(evt.CommandName, evt.Command); collection != "" {
+		span.SetTag("db.mongo.collection", collection)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.spans[mongoCommandKey{evt.ConnectionID, evt.RequestID}] = span
+}
+
+func (t *mongoCommandTracer) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	if span := t.finishing(evt.CommandFinishedEvent); span != nil {
+		span.Finish()
+	}
+}
+
+func (t *mongoCommandTracer) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	if span := t.finishing(evt.CommandFinishedEvent); span != nil {
+		tags.Error.Set(span, true)
+		span.SetTag("db.mongo.failure", evt.Failure)
+		span.LogKV("error", evt.Failure)
+		span.Finish()
+	}
+}
+
+// finishing takes the span of the finished command and tags the duration, nil if it is not started
+func (t *mongoCommandTracer) finishing(evt event.CommandFinishedEvent) opentracing.Span {
+	key := mongoCommandKey{evt.ConnectionID, evt.RequestID}
+	t.Lock()
+	span, ok := t.spans[key]
+	delete(t.spans, key)
+	t.Unlock()
+	if !ok {
+		return nil
+	}
+	span.SetTag("db.duration", time.Duration(evt.DurationNanos).String())
+	return span
+}
+
+// statement renders the command capped to the max size
+func (t *mongoCommandTracer) statement(command bson.Raw) string {
+	return t.renderer.truncate(t.renderer.render(command))
+}
+
+// mongoAddress returns the server address of the driver's connection ID, such as "localhost:27017[-3]"
+func mongoAddress(connectionID string) string {
+	if i := strings.LastIndex(connectionID, "[-"); i >= 0 {
+		return connectionID[:i]
+	}
+	return connectionID
+}
+
+// mongoCollection returns the collection of the command, which is the value of the command name,
+// "" if the command is not on a collection, such as {"aggregate": 1} on the database.
+func mongoCollection(commandName string, command bson.Raw) string {
+	if commandName == "getMore" {
+		if v, err := command.LookupErr("collection"); err == nil && v.Type == bsontype.String {
+			return v.StringValue()
+		}
+		return ""
+	}
+	v, err := command.LookupErr(commandName)
+	if err != nil || v.Type != bsontype.String {
+		return ""
+	}
+	return v.StringValue()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMongoCollection(t *testing.T) {
+	tests := []struct {
+		command string
+		doc     bson.D
+		want    string
+	}{
+		{"find", bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{}}}, "users"},
+		{"aggregate", bson.D{{Key: "aggregate", Value: 1}}, ""},
+		{"getMore", bson.D{{Key: "getMore", Value: int64(1)}, {Key: "collection", Value: "users"}}, "users"},
+		{"ping", bson.D{{Key: "ping", Value: 1}}, ""},
+	}
+	for _, tt := range tests {
+		raw, err := bson.Marshal(tt.doc)
+		if err != nil {
+			t.Fatalf("bson.Marshal() error = %v", err)
+		}
+		if got := mongoCollection(tt.command, raw); got != tt.want {
+			t.Errorf("mongoCollection(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestNewMongoCommandTracer(t *testing.T) {
+	tracer := opentracing.GlobalTracer().(*mocktracer.MockTracer)
+	parent := tracer.StartSpan("handler")
+	ctx := opentracing.ContextWithSpan(context.TODO(), parent)
+	cm := NewMongoCommandTracer()
+
+	find, _ := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "age", Value: 18}}}})
+	cm.Started(ctx, &event.CommandStartedEvent{
+		Command: find, DatabaseName: "app", CommandName: "find", RequestID: 1, ConnectionID: "localhost:27017[-1]",
+	})
+	insert, _ := bson.Marshal(bson.D{{Key: "insert", Value: "users"}})
+	cm.Started(ctx, &event.CommandStartedEvent{
+		Command: insert, DatabaseName: "app", CommandName: "insert", RequestID: 2, ConnectionID: "localhost:27017[-2]",
+	})
+	cm.Failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", RequestID: 2, ConnectionID: "localhost:27017[-2]"},
+		Failure:              "duplicate key",
+	})
+	cm.Succeeded(ctx, &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{DurationNanos: 1500000, CommandName: "find", RequestID: 1, ConnectionID: "localhost:27017[-1]"},
+	})
+
+	spans := map[string]*mocktracer.MockSpan{}
+	parentID := parent.Context().(mocktracer.MockSpanContext).SpanID
+	for _, span := range tracer.FinishedSpans() {
+		if span.ParentID == parentID {
+			spans[span.Tag("db.mongo.command").(string)] = span
+		}
+	}
+	if len(spans) != 2 {
+		t.Fatalf("finished spans = %v, want find and insert", spans)
+	}
+	want := map[string]interface{}{
+		string(tags.DBType):      "mongo",
+		string(tags.DBInstance):  "app",
+		string(tags.DBStatement): `{"find":"users","filter":{"age":"?"}}`,
+		string(tags.PeerAddress): "localhost:27017",
+		"db.mongo.collection":    "users",
+		"db.duration":            "1.5ms",
+	}
+	for key, value := range want {
+		if got := spans["find"].Tag(key); got != value {
+			t.Errorf("find span tag %s = %v, want %v", key, got, value)
+		}
+	}
+	if spans["insert"].Tag(string(tags.Error)) != true || spans["insert"].Tag("db.mongo.failure") != "duplicate key" {
+		t.Errorf("insert span tags = %v, want the failure", spans["insert"].Tags())
+	}
+}
+
+func TestMongoCommandTracer_statement(t *testing.T) {
+	lookup, _ := bson.Marshal(bson.D{
+		{Key: "aggregate", Value: "orders"},
+		{Key: "pipeline", Value: bson.A{
+			bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "users"}, {Key: "localField", Value: "uid"}}}},
+			bson.D{{Key: "$match", Value: bson.D{{Key: "age", Value: 18}}}},
+		}},
+	})
+	tests := []struct {
+		name    string
+		options []TracerOption
+		want    string
+	}{
+		{
+			name: "default",
+			want: `{"aggregate":"orders","pipeline":[{"$lookup":{"from":"?","localField":"?"}},{"$match":{"age":"?"}}]}`,
+		},
+		{
+			name:    "raw query option as raw command",
+			options: []TracerOption{RawQueryOption},
+			want:    `{"aggregate":"orders","pipeline":[{"$lookup":{"from":"users","localField":"uid"}},{"$match":{"age":18}}]}`,
+		},
+		{
+			name:    "ignore select columns option is ignored",
+			options: []TracerOption{IgnoreSelectColumnsOption},
+			want:    `{"aggregate":"orders","pipeline":[{"$lookup":{"from":"?","localField":"?"}},{"$match":{"age":"?"}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &mongoCommandTracer{renderer: newMongoCommandRenderer(tt.options...)}
+			if got := tracer.statement(lookup); got != tt.want {
+				t.Errorf("statement() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	_ AddressMonitor      = (*MultiMonitor)(nil)
+	_ CheckoutWaitMonitor = (*MultiMonitor)(nil)
+	_ TopologyMonitor     = (*MultiMonitor)(nil)
+	_ DBStatsMonitor      = (*MultiMonitor)(nil)
+)
+
+// MonitorErrors are the errors of the monitors a MultiMonitor forwards to
+type MonitorErrors []error
+
+func (e MonitorErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// MonitorPanicError is a panic of a monitor recovered by a MultiMonitor
+type MonitorPanicError struct {
+	Value interface{}
+}
+
+func (e *MonitorPanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// MultiMonitor forwards every event to several monitors, such as StatsD and Prometheus during a migration.
+// A monitor's error or panic does not stop the others, they are returned together as MonitorErrors.
+// The optional events, such as the ones of TopologyMonitor, are only forwarded to the monitors implementing them.
+type MultiMonitor struct {
+	monitors []Monitor
+}
+
+// NewMultiMonitor new a multi monitor forwarding to the monitors in order
+func NewMultiMonitor(monitors ...Monitor) *MultiMonitor {
+	return &MultiMonitor{
+		monitors: monitors,
+	}
+}
+
+// each calls fn with every monitor, the errors and the panics are collected
+func (m *MultiMonitor) each(fn func(Monitor) error) error {
+	var errs MonitorErrors
+	for i, monitor := range m.monitors {
+		if err := callMonitor(monitor, fn); err != nil {
+			errs = append(errs, fmt.Errorf("monitor %d (%T): %w", i, monitor, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func callMonitor(monitor Monitor, fn func(Monitor) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &MonitorPanicError{Value: r}
+		}
+	}()
+	return fn(monitor)
+}
+
+func (m *MultiMonitor) Log(w io.Writer, a any) {
+	_ = m.each(func(monitor Monitor) error {
+		monitor.Log(w, a)
+		return nil
+	})
+}
+
+func (m *MultiMonitor) Pool(op PoolOperation) error {
+	return m.each(func(monitor Monitor) error { return monitor.Pool(op) })
+}
+
+func (m *MultiMonitor) Conn(op ConnOperation) error {
+	return m.each(func(monitor Monitor) error { return monitor.Conn(op) })
+}
+
+func (m *MultiMonitor) Checkout(op CheckoutOperation) error {
+	return m.each(func(monitor Monitor) error { return monitor.Checkout(op) })
+}
+
+func (m *MultiMonitor) CheckoutWait(address string, d time.Duration) error {
+	return m.each(func(monitor Monitor) error {
+		if wm, ok := monitor.(CheckoutWaitMonitor); ok {
+			return wm.CheckoutWait(address, d)
+		}
+		return nil
+	})
+}
+
+func (m *MultiMonitor) Bulkhead(name string, op BulkheadOperation) error {
+	return m.each(func(monitor Monitor) error { return monitor.Bulkhead(name, op) })
+}
+
+// PoolAt impls AddressMonitor, the monitors which are not AddressMonitor get the event without the address
+func (m *MultiMonitor) PoolAt(address string, op PoolOperation) error {
+	return m.each(func(monitor Monitor) error { return newAddressReporter(monitor).pool(address, op) })
+}
+
+// ConnAt impls AddressMonitor, the monitors which are not AddressMonitor get the event without the address
+func (m *MultiMonitor) ConnAt(address string, op ConnOperation) error {
+	return m.each(func(monitor Monitor) error { return newAddressReporter(monitor).conn(address, op) })
+}
+
+// CheckoutAt impls AddressMonitor, the monitors which are not AddressMonitor get the event without the address
+func (m *MultiMonitor) CheckoutAt(address string, op CheckoutOperation) error {
+	return m.each(func(monitor Monitor) error { return newAddressReporter(monitor).checkout(address, op) })
+}
+
+func (m *MultiMonitor) RemoveAddress(address string) error {
+	return m.each(func(monitor Monitor) error { return newAddressReporter(monitor).removeAddress(address) })
+}
+
+func (m *MultiMonitor) Heartbeat(address string, d time.Duration, err error) error {
+	return m.each(func(monitor Monitor) error {
+		if tm, ok := monitor.(TopologyMonitor); ok {
+			return tm.Heartbeat(address, d, err)
+		}
+		return nil
+	})
+}
+
+func (m *MultiMonitor) Server(address string, op ServerOperation) error {
+	return m.each(func(monitor Monitor) error {
+		if tm, ok := monitor.(TopologyMonitor); ok {
+			return tm.Server(address, op)
+		}
+		return nil
+	})
+}
+
+func (m *MultiMonitor) DBStats(name string, stats sql.DBStats) error {
+	return m.each(func(monitor Monitor) error {
+		if sm, ok := monitor.(DBStatsMonitor); ok {
+			return sm.DBStats(name, stats)
+		}
+		return nil
+	})
+}
+
+func (m *MultiMonitor) removeDBStats(name string) {
+	for _, monitor := range m.monitors {
+		if r, ok := monitor.(dbStatsRemover); ok {
+			r.removeDBStats(name)
+		}
+	}
+}
+
+// Close closes the monitors which can be closed, such as PrometheusPoolMonitor
+func (m *MultiMonitor) Close() error {
+	return m.each(func(monitor Monitor) error {
+		if c, ok := monitor.(io.Closer); ok {
+			return c.Close()
+		}
+		return nil
+	})
+}
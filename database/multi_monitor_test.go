@@ -0,0 +1,66 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// failingMonitor fails or panics on every pool event on top of the default monitor
+type failingMonitor struct {
+	DefaultPoolMonitor
+	panics bool
+}
+
+func (m *failingMonitor) Pool(op PoolOperation) error {
+	if m.panics {
+		panic("boom")
+	}
+	return errors.New("push failed")
+}
+
+func TestMultiMonitor(t *testing.T) {
+	first, last := &DefaultPoolMonitor{}, &DefaultPoolMonitor{}
+	m := NewMultiMonitor(first, &failingMonitor{}, &failingMonitor{panics: true}, last)
+
+	err := m.Pool(PoolCreate)
+	var errs MonitorErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Pool() error = %v, want 2 errors", err)
+	}
+	if !strings.Contains(errs[0].Error(), "monitor 1") || !strings.Contains(errs[0].Error(), "push failed") {
+		t.Errorf("errs[0] = %v, want the error of monitor 1", errs[0])
+	}
+	var panicErr *MonitorPanicError
+	if !errors.As(errs[1], &panicErr) || panicErr.Value != "boom" {
+		t.Errorf("errs[1] = %v, want the recovered panic", errs[1])
+	}
+	if first.poolSize != 1 || last.poolSize != 1 {
+		t.Errorf("pool sizes = %d and %d, want the event forwarded to both", first.poolSize, last.poolSize)
+	}
+
+	if err := m.ConnAt("a:27017", ConnCreate); err != nil {
+		t.Errorf("ConnAt() error = %v", err)
+	}
+	if first.addresses["a:27017"] == nil || first.addresses["a:27017"].conns != 1 {
+		t.Errorf("state of a = %+v, want 1 conn", first.addresses["a:27017"])
+	}
+}
+
+func TestMultiMonitor_NewMongoDriverMonitor(t *testing.T) {
+	statsd, prom := &DefaultPoolMonitor{}, &DefaultPoolMonitor{}
+	pm := NewMongoDriverMonitor(NewMultiMonitor(statsd, prom))
+	for _, typ := range []string{event.PoolCreated, event.ConnectionCreated, event.GetStarted, event.GetSucceeded} {
+		pm.Event(&event.PoolEvent{Type: typ, Address: "a:27017"})
+	}
+	for _, m := range []*DefaultPoolMonitor{statsd, prom} {
+		if a := m.addresses["a:27017"]; a == nil || *a != (addressStats{pools: 1, conns: 1, occupied: 1}) {
+			t.Errorf("state of a = %+v, want 1 pool, 1 conn and 1 occupied", a)
+		}
+		if m.checkouts[CheckoutStart] != 1 || m.waits["a:27017"] == nil {
+			t.Errorf("checkouts = %v, waits = %v, want the checkout reported", m.checkouts, m.waits)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPushInterval = 10 * time.Second
+	defaultPushRetries  = 2
+	defaultPushBackoff  = 100 * time.Millisecond
+)
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// PoolMonitorOption defines the pool monitor's option
+type PoolMonitorOption func(*poolMonitorConfig)
+
+type poolMonitorConfig struct {
+	dbType         string
+	appName        string
+	cluster        string
+	subsystem      string
+	gatewayAddress string
+	job            string
+	grouping       map[string]string
+	registry       *prometheus.Registry
+	registerer     prometheus.Registerer
+	pushInterval   time.Duration
+	pushRetries    int
+	pushBackoff    time.Duration
+	onPushError    func(error)
+}
+
+// WithAppName sets the app name, which prefixes the StatsD stats and is the "app" label of the prometheus metrics
+func WithAppName(name string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.appName = name
+	}
+}
+
+// WithCluster sets the "cluster" label of the prometheus metrics
+func WithCluster(name string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.cluster = name
+	}
+}
+
+// WithSubsystem sets the subsystem of the prometheus metric names, it is "database" by default
+func WithSubsystem(name string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.subsystem = name
+	}
+}
+
+// WithGatewayAddress sets the address of the prometheus pushgateway
+func WithGatewayAddress(address string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.gatewayAddress = address
+	}
+}
+
+// WithJob sets the job the metrics are pushed as, it is "<db type>-pool-monitor" by default
+func WithJob(job string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.job = job
+	}
+}
+
+// WithGrouping adds a grouping label to the pushed metrics
+func WithGrouping(name, value string) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.grouping[name] = value
+	}
+}
+
+// WithRegistry registers the metrics to reg instead of a new registry
+func WithRegistry(reg *prometheus.Registry) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.registry = reg
+	}
+}
+
+// WithRegisterer registers the metrics of the pull monitor to reg as well, such as prometheus.DefaultRegisterer
+func WithRegisterer(reg prometheus.Registerer) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.registerer = reg
+	}
+}
+
+// WithPushInterval sets how often the changed metrics are pushed in background, it is 10s by default
+func WithPushInterval(d time.Duration) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.pushInterval = d
+	}
+}
+
+// WithPushRetries retries a failed push n times, waiting backoff doubled on every retry.
+// The metrics are pushed again in the next interval if all of them fail.
+func WithPushRetries(n int, backoff time.Duration) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.pushRetries = n
+		c.pushBackoff = backoff
+	}
+}
+
+// WithPushErrorHandler passes the push errors to fn, which are only logged with DEBUG_MONITOR by default
+func WithPushErrorHandler(fn func(error)) PoolMonitorOption {
+	return func(c *poolMonitorConfig) {
+		c.onPushError = fn
+	}
+}
+
+func newPoolMonitorConfig(dbType string, options ...PoolMonitorOption) *poolMonitorConfig {
+	c := &poolMonitorConfig{
+		dbType:       dbType,
+		subsystem:    defaultSubsystem,
+		job:          dbType + "-pool-monitor",
+		grouping:     make(map[string]string),
+		pushInterval: defaultPushInterval,
+		pushRetries:  defaultPushRetries,
+		pushBackoff:  defaultPushBackoff,
+	}
+	for _, op := range options {
+		op(c)
+	}
+	return c
+}
+
+// statsDPrefix returns the app name, or "database.<db type>" without it
+func (c *poolMonitorConfig) statsDPrefix() string {
+	if c.appName == "" {
+		return "database." + c.dbType
+	}
+	return c.appName
+}
+
+func (c *poolMonitorConfig) validatePrometheusPull() error {
+	if c.appName == "" {
+		return errors.New("database: app name is required by the prometheus pool monitor")
+	}
+	if !metricNameRegexp.MatchString(c.subsystem) {
+		return fmt.Errorf("database: subsystem %q is not a valid metric name", c.subsystem)
+	}
+	return nil
+}
+
+func (c *poolMonitorConfig) validatePrometheus() error {
+	if err := c.validatePrometheusPull(); err != nil {
+		return err
+	}
+	if c.gatewayAddress == "" {
+		return errors.New("database: gateway address is required by the prometheus pool monitor")
+	}
+	if c.job == "" {
+		return errors.New("database: job is required by the prometheus pool monitor")
+	}
+	for name := range c.grouping {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("database: grouping %q is not a valid label name", name)
+		}
+	}
+	if c.pushInterval <= 0 {
+		return fmt.Errorf("database: non-positive push interval %s", c.pushInterval)
+	}
+	if c.pushRetries < 0 || c.pushBackoff < 0 {
+		return fmt.Errorf("database: negative push retries %d or backoff %s", c.pushRetries, c.pushBackoff)
+	}
+	return nil
+}
+
+// NewPoolMonitor new a pool monitor of the given type for the pools of dbType, such as "mongo" or "mysql".
+// The invalid options are reported as errors.
+func NewPoolMonitor(dbType string, t MonitorType, options ...PoolMonitorOption) (Monitor, error) {
+	c := newPoolMonitorConfig(dbType, options...)
+	switch t {
+	case StatsD:
+		return &StatsDPoolMonitor{
+			prefix: c.statsDPrefix(),
+		}, nil
+	case Prometheus:
+		m, err := newPrometheusPoolMonitor(c)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case PrometheusPull:
+		m, err := newPrometheusPullPoolMonitor(c)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return &DefaultPoolMonitor{}, nil
+	}
+}
@@ -0,0 +1,359 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestNewPoolMonitor_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []PoolMonitorOption
+		want    string
+	}{
+		{
+			name:    "TestNewPoolMonitor_NoAppName",
+			options: []PoolMonitorOption{WithGatewayAddress("http://localhost:9091")},
+			want:    "app name is required",
+		},
+		{
+			name:    "TestNewPoolMonitor_Subsystem",
+			options: []PoolMonitorOption{WithAppName("app"), WithGatewayAddress("http://localhost:9091"), WithSubsystem("my-db")},
+			want:    "not a valid metric name",
+		},
+		{
+			name:    "TestNewPoolMonitor_NoGateway",
+			options: []PoolMonitorOption{WithAppName("app")},
+			want:    "gateway address is required",
+		},
+		{
+			name:    "TestNewPoolMonitor_Grouping",
+			options: []PoolMonitorOption{WithAppName("app"), WithGatewayAddress("http://localhost:9091"), WithGrouping("zone-id", "a")},
+			want:    "not a valid label name",
+		},
+		{
+			name:    "TestNewPoolMonitor_PushInterval",
+			options: []PoolMonitorOption{WithAppName("app"), WithGatewayAddress("http://localhost:9091"), WithPushInterval(-time.Second)},
+			want:    "non-positive push interval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMongoPoolMonitor(Prometheus, tt.options...)
+			if m != nil || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewMongoPoolMonitor() = %v, %v, want error %q", m, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPoolMonitor_Registry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	options := []PoolMonitorOption{WithAppName("app"), WithGatewayAddress("http://localhost:9091"), WithRegistry(reg)}
+	m, err := NewMongoPoolMonitor(Prometheus, options...)
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	defer m.(*PrometheusPoolMonitor).Close()
+	other, err := NewPoolMonitor("mysql", Prometheus, options...)
+	if err != nil {
+		t.Fatalf("NewPoolMonitor() of another db type sharing the registry error = %v", err)
+	}
+	defer other.(*PrometheusPoolMonitor).Close()
+	m.Conn(ConnCreate)
+	other.Conn(ConnCreate)
+	if n, err := testutil.GatherAndCount(reg, "database_conn_current"); err != nil || n != 2 {
+		t.Errorf("GatherAndCount() = %d, %v, want a series per db type", n, err)
+	}
+
+	if err := reg.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "other", Name: "pool_current", Help: "pool ",
+	}, poolLabels)); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := NewMongoPoolMonitor(Prometheus, append(options, WithSubsystem("other"))...); err == nil {
+		t.Errorf("NewMongoPoolMonitor() over another kind of collector error = nil")
+	}
+}
+
+func TestNewPoolMonitor_SharedRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mongo, err := NewPoolMonitor("mongo", PrometheusPull, WithAppName("app"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewPoolMonitor() error = %v", err)
+	}
+	mysql, err := NewPoolMonitor("mysql", PrometheusPull, WithAppName("app"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewPoolMonitor() of another db type error = %v", err)
+	}
+	mongo.Conn(ConnCreate)
+	mysql.Conn(ConnCreate)
+	mysql.Conn(ConnCreate)
+	if n, err := testutil.GatherAndCount(reg, "database_conn_current"); err != nil || n != 2 {
+		t.Errorf("GatherAndCount() = %d, %v, want a series per db type", n, err)
+	}
+	rec := httptest.NewRecorder()
+	mysql.(*PrometheusPullPoolMonitor).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `database_conn_current{address="",app="app",cluster="",db_type="mysql"} 2`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("metrics = %q, want %q in it", rec.Body.String(), want)
+	}
+}
+
+func TestPrometheusPoolMonitor_Push(t *testing.T) {
+	paths := make(chan string, 10)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	m, err := NewMongoPoolMonitor(Prometheus,
+		WithAppName("app"), WithGatewayAddress(gateway.URL), WithJob("pools"), WithGrouping("instance", "host-1"),
+		WithPushInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	defer m.(*PrometheusPoolMonitor).Close()
+	if err := m.Pool(PoolCreate); err != nil {
+		t.Fatalf("Pool() error = %v", err)
+	}
+	// the grouping labels are in no particular order
+	select {
+	case path := <-paths:
+		for _, want := range []string{"/metrics/job/pools/", "/kind/mongo", "/instance/host-1"} {
+			if !strings.Contains(path, want) {
+				t.Errorf("push path = %q, want %q in it", path, want)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("metrics not pushed")
+	}
+}
+
+func TestPrometheusPoolMonitor_Close(t *testing.T) {
+	paths := make(chan string, 100)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	m, err := NewMongoPoolMonitor(Prometheus,
+		WithAppName("app"), WithGatewayAddress(gateway.URL), WithPushInterval(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := m.Conn(ConnCreate); err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+	}
+	if len(paths) != 0 {
+		t.Errorf("pushed %d times before the interval", len(paths))
+	}
+	if err := m.(*PrometheusPoolMonitor).Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(paths) != 1 {
+		t.Errorf("pushed %d times on close, want 1", len(paths))
+	}
+	if err := m.(*PrometheusPoolMonitor).Close(); err != nil || len(paths) != 1 {
+		t.Errorf("Close() again = %v, pushed %d times", err, len(paths))
+	}
+}
+
+func TestPrometheusPoolMonitor_PushRetries(t *testing.T) {
+	var calls int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer gateway.Close()
+
+	var errs []error
+	m, err := NewMongoPoolMonitor(Prometheus,
+		WithAppName("app"), WithGatewayAddress(gateway.URL), WithPushInterval(time.Hour),
+		WithPushRetries(2, time.Millisecond), WithPushErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	if err := m.Pool(PoolCreate); err != nil {
+		t.Fatalf("Pool() error = %v", err)
+	}
+	if err := m.(*PrometheusPoolMonitor).Close(); err == nil {
+		t.Errorf("Close() error = nil, want the push error")
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 || len(errs) != 1 {
+		t.Errorf("pushed %d times with %d errors, want 3 and 1", n, len(errs))
+	}
+}
+
+func TestPrometheusPullPoolMonitor(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewMongoPoolMonitor(PrometheusPull, WithAppName("my-app"), WithCluster("main"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	for _, op := range []ConnOperation{ConnCreate, ConnCreate, Connoccupy} {
+		if err := m.Conn(op); err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+	}
+	if n, err := testutil.GatherAndCount(reg, "database_conn_current"); err != nil || n != 1 {
+		t.Errorf("GatherAndCount() = %d, %v, want 1", n, err)
+	}
+	for _, address := range []string{"a:27017", "b:27017", "a:27017"} {
+		if err := m.(CheckoutWaitMonitor).CheckoutWait(address, time.Millisecond); err != nil {
+			t.Fatalf("CheckoutWait() error = %v", err)
+		}
+	}
+	if n, err := testutil.GatherAndCount(reg, "database_checkout_wait_seconds"); err != nil || n != 2 {
+		t.Errorf("GatherAndCount() = %d, %v, want a histogram per address", n, err)
+	}
+
+	tm := m.(TopologyMonitor)
+	if err := tm.Heartbeat("a:27017", time.Millisecond, nil); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+	if err := tm.Server("a:27017", PrimaryChange); err != nil {
+		t.Fatalf("Server() error = %v", err)
+	}
+	for _, name := range []string{"database_heartbeat_seconds", "database_server_events_total"} {
+		if n, err := testutil.GatherAndCount(reg, name); err != nil || n != 1 {
+			t.Errorf("GatherAndCount(%s) = %d, %v, want 1", name, n, err)
+		}
+	}
+
+	sm := m.(DBStatsMonitor)
+	for _, waits := range []int64{2, 5} {
+		if err := sm.DBStats("main", sql.DBStats{OpenConnections: 3, WaitCount: waits}); err != nil {
+			t.Fatalf("DBStats() error = %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(m.(*PrometheusPullPoolMonitor).collectors.counter(monitorKindSQLWait, []string{"my-app", "mongo", "main", "", "main"})); got != 5 {
+		t.Errorf("sql_wait_total = %v, want 5", got)
+	}
+
+	am := m.(AddressMonitor)
+	for _, address := range []string{"a:27017", "b:27017"} {
+		if err := am.ConnAt(address, ConnCreate); err != nil {
+			t.Fatalf("ConnAt() error = %v", err)
+		}
+	}
+	if err := am.RemoveAddress("b:27017"); err != nil {
+		t.Fatalf("RemoveAddress() error = %v", err)
+	}
+	// the series without address and the one of a are left
+	if n, err := testutil.GatherAndCount(reg, "database_conn_current"); err != nil || n != 2 {
+		t.Errorf("GatherAndCount() = %d, %v, want 2", n, err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.(*PrometheusPullPoolMonitor).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`database_conn_current{address="",app="my-app",cluster="main",db_type="mongo"} 2`,
+		`database_conn_occupy_current{address="",app="my-app",cluster="main",db_type="mongo"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics = %q, want %q in it", rec.Body.String(), want)
+		}
+	}
+}
+
+func TestPrometheusPullPoolMonitor_RemoveAddress(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewMongoPoolMonitor(PrometheusPull, WithAppName("my-app"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewMongoPoolMonitor() error = %v", err)
+	}
+	pm := m.(*PrometheusPullPoolMonitor)
+	for _, address := range []string{"a:27017", "b:27017"} {
+		pm.PoolAt(address, PoolCreate)
+		pm.PoolAt(address, PoolClose)
+		pm.ConnAt(address, ConnReady)
+		pm.CheckoutAt(address, CheckoutStart)
+		pm.CheckoutAt(address, CheckoutTimeout)
+		pm.CheckoutWait(address, time.Millisecond)
+		pm.Heartbeat(address, time.Millisecond, nil)
+		pm.Heartbeat(address, time.Millisecond, errors.New("timeout"))
+		pm.Server(address, ServerOpen)
+	}
+	if err := pm.RemoveAddress("b:27017"); err != nil {
+		t.Fatalf("RemoveAddress() error = %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	// the pool closes, the heartbeats and the server events of the removed address are kept
+	keptOfRemoved := map[string]bool{
+		"database_pool_closed_total":      true,
+		"database_heartbeat_seconds":      true,
+		"database_heartbeat_failed_total": true,
+		"database_server_events_total":    true,
+	}
+	kept := 0
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "address" {
+					continue
+				}
+				switch label.GetValue() {
+				case "a:27017":
+					kept++
+				case "b:27017":
+					if !keptOfRemoved[family.GetName()] {
+						t.Errorf("%s of the removed address is kept", family.GetName())
+					}
+				}
+			}
+		}
+	}
+	if kept != 9 {
+		t.Errorf("series of a = %d, want 9", kept)
+	}
+}
+
+func TestPrometheusPullPoolMonitor_PoolClosed(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPoolMonitor("mongo", PrometheusPull, WithAppName("my-app"), WithRegisterer(reg))
+	if err != nil {
+		t.Fatalf("NewPoolMonitor() error = %v", err)
+	}
+	pm := NewMongoDriverMonitor(m)
+	for _, typ := range []string{event.PoolCreated, event.ConnectionCreated, event.PoolClosedEvent} {
+		pm.Event(&event.PoolEvent{Type: typ, Address: "a:27017"})
+	}
+	m.(TopologyMonitor).Server("a:27017", ServerClose)
+
+	closed := m.(*PrometheusPullPoolMonitor).collectors.counter(monitorKindPoolClosed, []string{"my-app", "mongo", "", "a:27017"})
+	if got := testutil.ToFloat64(closed); got != 1 {
+		t.Errorf("pool_closed_total = %v, want 1", got)
+	}
+	for name, want := range map[string]int{
+		"database_pool_closed_total":   1,
+		"database_server_events_total": 1,
+		"database_pool_current":        0,
+		"database_conn_current":        0,
+	} {
+		if n, err := testutil.GatherAndCount(reg, name); err != nil || n != want {
+			t.Errorf("GatherAndCount(%s) = %d, %v, want %d", name, n, err, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	fixtureKindQuery = "query"
+	fixtureKindExec  = "exec"
+)
+
+// UnexpectedStatementError is returned in replay mode for the statements not found in the fixture
+type UnexpectedStatementError struct {
+	Statement string
+	Args      []interface{}
+}
+
+func (e *UnexpectedStatementError) Error() string {
+	return fmt.Sprintf("database: unexpected statement in replay: %s %v", e.Statement, e.Args)
+}
+
+// RecordReplayWrapper defines a record-and-replay wrapper.
+// In record mode it calls the database and captures every statement with its outcome,
+// in replay mode it serves the captured outcomes without a database.
+type RecordReplayWrapper struct {
+	path      string
+	replaying bool
+	entries   []*fixtureEntry
+	pending   map[string][]*fixtureEntry
+	sync.Mutex
+}
+
+// NewRecordWrapper new a wrapper recording into the fixture file at path, which is written by Save
+func NewRecordWrapper(path string) *RecordReplayWrapper {
+	return &RecordReplayWrapper{
+		path: path,
+	}
+}
+
+// NewReplayWrapper new a wrapper replaying the fixture file at path.
+// The same statement with the same args is replayed in the order it was recorded.
+func NewReplayWrapper(path string) (*RecordReplayWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &RecordReplayWrapper{
+		path:      path,
+		replaying: true,
+		pending:   make(map[string][]*fixtureEntry),
+	}
+	if err := json.Unmarshal(data, &w.entries); err != nil {
+		return nil, fmt.Errorf("database: invalid fixture %s: %w", path, err)
+	}
+	for _, e := range w.entries {
+		key := fixtureKey(e.Kind, e.Statement, e.Args)
+		w.pending[key] = append(w.pending[key], e)
+	}
+	return w, nil
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *RecordReplayWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		if w.replaying {
+			e, err := w.replay(fixtureKindQuery, query, args)
+			if err != nil {
+				return nil, err
+			}
+			set, err := e.rowSet()
+			if err != nil {
+				return nil, err
+			}
+			return set.open(ctx)
+		}
+
+		e := newFixtureEntry(fixtureKindQuery, query, args)
+		rows, err := fn(ctx, query, args...)
+		if err != nil {
+			e.Error = err.Error()
+			w.record(e)
+			return nil, err
+		}
+		set, err := materializeRows(rows)
+		if err != nil {
+			e.Error = err.Error()
+			w.record(e)
+			return nil, err
+		}
+		// the caller gets the rows anyway, the entry replays the conversion error
+		if err := e.setRows(set); err != nil {
+			e.Columns, e.Rows = nil, nil
+			e.Error = err.Error()
+		}
+		w.record(e)
+		return set.open(ctx)
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *RecordReplayWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if w.replaying {
+			e, err := w.replay(fixtureKindExec, query, args)
+			if err != nil {
+				return nil, err
+			}
+			return result{lastInsertID: e.LastInsertID, rowsAffected: e.RowsAffected}, nil
+		}
+
+		e := newFixtureEntry(fixtureKindExec, query, args)
+		res, err := fn(ctx, query, args...)
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.LastInsertID, _ = res.LastInsertId()
+			e.RowsAffected, _ = res.RowsAffected()
+		}
+		w.record(e)
+		return res, err
+	}
+}
+
+// Save writes the recorded statements to the fixture file
+func (w *RecordReplayWrapper) Save() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.replaying {
+		return errors.New("database: a replaying fixture can not be saved")
+	}
+	data, err := json.MarshalIndent(w.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path, data, 0o644)
+}
+
+// Remaining returns how many recorded statements are not replayed yet
+func (w *RecordReplayWrapper) Remaining() int {
+	w.Lock()
+	defer w.Unlock()
+	n := 0
+	for _, entries := range w.pending {
+		n += len(entries)
+	}
+	return n
+}
+
+func (w *RecordReplayWrapper) record(e *fixtureEntry) {
+	w.Lock()
+	defer w.Unlock()
+	w.entries = append(w.entries, e)
+}
+
+// replay pops the next recorded outcome of the statement, the recorded error is returned as it is
+func (w *RecordReplayWrapper) replay(kind, query string, args []interface{}) (*fixtureEntry, error) {
+	key := fixtureKey(kind, query, newFixtureValues(args))
+	w.Lock()
+	entries := w.pending[key]
+	if len(entries) == 0 {
+		w.Unlock()
+		return nil, &UnexpectedStatementError{Statement: query, Args: args}
+	}
+	e := entries[0]
+	w.pending[key] = entries[1:]
+	w.Unlock()
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+	return e, nil
+}
+
+// fixtureEntry is a recorded statement with its outcome
+type fixtureEntry struct {
+	Kind         string           `json:"kind"`
+	Statement    string           `json:"statement"`
+	Args         []fixtureValue   `json:"args,omitempty"`
+	Columns      []string         `json:"columns,omitempty"`
+	Rows         [][]fixtureValue `json:"rows,omitempty"`
+	LastInsertID int64            `json:"last_insert_id,omitempty"`
+	RowsAffected int64            `json:"rows_affected,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+func newFixtureEntry(kind, query string, args []interface{}) *fixtureEntry {
+	return &fixtureEntry{
+		Kind:      kind,
+		Statement: query,
+		Args:      newFixtureValues(args),
+	}
+}
+
+func (e *fixtureEntry) setRows(set *rowSet) error {
+	e.Columns = set.columns
+	for _, row := range set.rows {
+		values := make([]fixtureValue, len(row))
+		for i, v := range row {
+			fv, err := newFixtureValue(v)
+			if err != nil {
+				return err
+			}
+			values[i] = fv
+		}
+		e.Rows = append(e.Rows, values)
+	}
+	return nil
+}
+
+func (e *fixtureEntry) rowSet() (*rowSet, error) {
+	set := &rowSet{columns: e.Columns}
+	for _, values := range e.Rows {
+		row := make([]driver.Value, len(values))
+		for i, fv := range values {
+			v, err := fv.value()
+			if err != nil {
+				return nil, err
+			}
+			row[i] = v
+		}
+		set.rows = append(set.rows, row)
+	}
+	return set, nil
+}
+
+func fixtureKey(kind, query string, args []fixtureValue) string {
+	data, _ := json.Marshal(args)
+	return kind + "\x00" + query + "\x00" + string(data)
+}
+
+// fixtureValue is a driver value which keeps its type in JSON,
+// the values are converted as the driver would do before they are kept
+type fixtureValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// newFixtureValues converts the args, the unsupported ones are kept as strings
+func newFixtureValues(args []interface{}) []fixtureValue {
+	if len(args) == 0 {
+		return nil
+	}
+	values := make([]fixtureValue, len(args))
+	for i, arg := range args {
+		v, err := newFixtureValue(arg)
+		if err != nil {
+			v, _ = newFixtureValue(fmt.Sprint(arg))
+		}
+		values[i] = v
+	}
+	return values
+}
+
+func newFixtureValue(v interface{}) (fixtureValue, error) {
+	if cv, err := driver.DefaultParameterConverter.ConvertValue(v); err == nil {
+		v = cv
+	}
+	var typ string
+	switch v.(type) {
+	case nil:
+		return fixtureValue{Type: "null"}, nil
+	case int64:
+		typ = "int64"
+	case float64:
+		typ = "float64"
+	case bool:
+		typ = "bool"
+	case string:
+		typ = "string"
+	case []byte:
+		typ = "bytes"
+	case time.Time:
+		typ = "time"
+	default:
+		return fixtureValue{}, fmt.Errorf("database: unsupported fixture value type %T", v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fixtureValue{}, err
+	}
+	return fixtureValue{Type: typ, Value: data}, nil
+}
+
+func (f fixtureValue) value() (driver.Value, error) {
+	var err error
+	switch f.Type {
+	case "null":
+		return nil, nil
+	case "int64":
+		var v int64
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	case "float64":
+		var v float64
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	case "time":
+		var v time.Time
+		err = json.Unmarshal(f.Value, &v)
+		return v, err
+	default:
+		return nil, fmt.Errorf("database: unsupported fixture value type %q", f.Type)
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRecordReplayWrapper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	created := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	ctx := context.TODO()
+
+	recorder := NewRecordWrapper(path)
+	query := recorder.WrapQueryContext(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "created"}).AddRow(1, []byte("a"), created).AddRow(2, nil, created),
+		)
+		return db.QueryContext(ctx, query, args...)
+	}, "")
+	exec := recorder.WrapExecContext(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if len(args) == 0 {
+			return nil, errors.New("boom")
+		}
+		return sqlmock.NewResult(42, 1), nil
+	}, "")
+	rows, err := query(ctx, "SELECT id, name, created FROM a WHERE id > ?", 0)
+	if err != nil {
+		t.Fatalf("recorded query error = %v", err)
+	}
+	rows.Close()
+	exec(ctx, "INSERT INTO a (name) VALUES (?)", "c")
+	exec(ctx, "DELETE FROM a")
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	replayer, err := NewReplayWrapper(path)
+	if err != nil {
+		t.Fatalf("NewReplayWrapper() error = %v", err)
+	}
+	query = replayer.WrapQueryContext(nil, "")
+	exec = replayer.WrapExecContext(nil, "")
+
+	rows, err = query(ctx, "SELECT id, name, created FROM a WHERE id > ?", 0)
+	if err != nil {
+		t.Fatalf("replayed query error = %v", err)
+	}
+	var (
+		id   int64
+		name sql.NullString
+		at   time.Time
+	)
+	if !rows.Next() {
+		t.Fatalf("replayed rows are empty")
+	}
+	if err := rows.Scan(&id, &name, &at); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if id != 1 || name.String != "a" || !at.Equal(created) {
+		t.Errorf("replayed row = %d %v %v", id, name, at)
+	}
+	rows.Close()
+
+	res, err := exec(ctx, "INSERT INTO a (name) VALUES (?)", "c")
+	if err != nil {
+		t.Fatalf("replayed exec error = %v", err)
+	}
+	if insertID, _ := res.LastInsertId(); insertID != 42 {
+		t.Errorf("LastInsertId() = %d, want 42", insertID)
+	}
+	if _, err := exec(ctx, "DELETE FROM a"); err == nil || err.Error() != "boom" {
+		t.Errorf("replayed exec error = %v, want boom", err)
+	}
+
+	var unexpected *UnexpectedStatementError
+	if _, err := exec(ctx, "INSERT INTO a (name) VALUES (?)", "c"); !errors.As(err, &unexpected) {
+		t.Errorf("exec() replayed twice error = %v, want UnexpectedStatementError", err)
+	}
+	if _, err := query(ctx, "SELECT id FROM b"); !errors.As(err, &unexpected) {
+		t.Errorf("unrecorded query error = %v, want UnexpectedStatementError", err)
+	}
+	if n := replayer.Remaining(); n != 0 {
+		t.Errorf("Remaining() = %d, want 0", n)
+	}
+}
+
+func TestRecordReplayWrapper_UnsupportedValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	ctx := context.TODO()
+
+	recorder := NewRecordWrapper(path)
+	query := recorder.WrapQueryContext(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "tags"}).AddRow(1, []int{1, 2}))
+		return db.QueryContext(ctx, query, args...)
+	}, "")
+	rows, err := query(ctx, "SELECT id, tags FROM a")
+	if err != nil {
+		t.Fatalf("recorded query error = %v", err)
+	}
+	var (
+		id   int64
+		tags interface{}
+	)
+	if !rows.Next() {
+		t.Fatalf("recorded rows are empty")
+	}
+	if err := rows.Scan(&id, &tags); err != nil || id != 1 {
+		t.Errorf("Scan() = %d, %v, want 1", id, err)
+	}
+	rows.Close()
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	replayer, err := NewReplayWrapper(path)
+	if err != nil {
+		t.Fatalf("NewReplayWrapper() error = %v", err)
+	}
+	if _, err := replayer.WrapQueryContext(nil, "")(ctx, "SELECT id, tags FROM a"); err == nil {
+		t.Errorf("replayed query of an unsupported value error = nil")
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	tags "github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 10 * time.Millisecond
+	defaultRetryMaxDelay    = time.Second
+)
+
+// transientErrorNumbers are the server error numbers worth retrying
+// * MySQL 1213: deadlock found when trying to get lock
+// * MySQL 1205: lock wait timeout exceeded
+// * MsSQL 1205: transaction was deadlocked and has been chosen as the deadlock victim
+var transientErrorNumbers = map[int64]bool{
+	1205: true,
+	1213: true,
+}
+
+// numberedErrorTypes are the driver error types whose Number field is the server error number
+var numberedErrorTypes = map[string]bool{
+	"github.com/go-sql-driver/mysql.MySQLError": true,
+}
+
+// RetryWrapper defines a retry wrapper
+// which retries the queries and the idempotent execs on transient errors.
+// The statements of a transaction must not be retried one by one: a deadlock rolls back the whole transaction,
+// and a broken connection loses it, so the retried statement would run outside of it.
+// Mark them by ContextWithTransaction, or do not wrap the functions of a Tx, and retry the whole transaction instead.
+type RetryWrapper struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// RetryOption defines the retry wrapper's option
+type RetryOption func(*RetryWrapper)
+
+// WithRetryMaxAttempts sets how many times a statement is tried, including the first attempt
+func WithRetryMaxAttempts(n int) RetryOption {
+	return func(r *RetryWrapper) {
+		if n > 0 {
+			r.maxAttempts = n
+		}
+	}
+}
+
+// WithRetryBackoff sets the base and the max delay of the exponential backoff
+func WithRetryBackoff(base, max time.Duration) RetryOption {
+	return func(r *RetryWrapper) {
+		if base > 0 {
+			r.baseDelay = base
+		}
+		if max > 0 {
+			r.maxDelay = max
+		}
+	}
+}
+
+// NewRetryWrapper new a retry wrapper, by default it tries 3 times with backoff from 10ms up to 1s
+func NewRetryWrapper(options ...RetryOption) *RetryWrapper {
+	r := &RetryWrapper{
+		maxAttempts: defaultRetryMaxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+	}
+	for _, op := range options {
+		op(r)
+	}
+	return r
+}
+
+type idempotentKey struct{}
+
+// ContextWithIdempotent marks the exec statements called with the returned context as safe to retry
+func ContextWithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (r *RetryWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		var rows *sql.Rows
+		err := r.do(ctx, func(ctx context.Context) (err error) {
+			rows, err = fn(ctx, query, args...)
+			return err
+		})
+		return rows, err
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+// Only the execs marked by ContextWithIdempotent will be retried.
+func (r *RetryWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if !isIdempotent(ctx) {
+			return fn(ctx, query, args...)
+		}
+		var res sql.Result
+		err := r.do(ctx, func(ctx context.Context) (err error) {
+			res, err = fn(ctx, query, args...)
+			return err
+		})
+		return res, err
+	}
+}
+
+// do calls the call until it succeeds, fails with a non-transient error or runs out of attempts.
+// Every attempt is traced as a child span of the span in ctx.
+// The call is tried once if ctx marks a transaction.
+func (r *RetryWrapper) do(ctx context.Context, call func(context.Context) error) error {
+	if isTransaction(ctx) {
+		return call(ctx)
+	}
+	for attempt := 1; ; attempt++ {
+		span, attemptCtx := opentracing.StartSpanFromContext(ctx, "retry")
+		span.SetTag("retry.attempt", attempt)
+		err := call(attemptCtx)
+		if err != nil {
+			tags.Error.Set(span, true)
+			span.LogKV("error", err.Error())
+		}
+		span.Finish()
+		if err == nil || attempt >= r.maxAttempts || !isTransientError(err) {
+			return err
+		}
+		if !r.wait(ctx, r.backoff(attempt)) {
+			return err
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: exponential growth with equal jitter
+func (r *RetryWrapper) backoff(attempt int) time.Duration {
+	d := r.baseDelay << uint(attempt-1)
+	if d <= 0 || d > r.maxDelay {
+		d = r.maxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// wait sleeps d, it gives up early when ctx is done or its deadline comes before d
+func (r *RetryWrapper) wait(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// isTransientError reports whether err is a deadlock, a lock wait timeout or a broken connection
+func isTransientError(err error) bool {
+	if isConnError(err) {
+		return true
+	}
+	n, ok := sqlErrorNumber(err)
+	return ok && transientErrorNumbers[n]
+}
+
+// isConnError reports whether err means the connection is broken
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// go-sql-driver/mysql returns ErrInvalidConn when the connection dies in the middle of a statement
+	if err.Error() == "invalid connection" {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// sqlErrorNumber gets the server error number from a driver error
+// * denisenkom/go-mssqldb exposes it by the SQLErrorNumber method
+// * go-sql-driver/mysql exposes it by the Number field of *MySQLError, which is read without importing the driver
+func sqlErrorNumber(err error) (int64, bool) {
+	var numbered interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &numbered) {
+		return int64(numbered.SQLErrorNumber()), true
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct || !numberedErrorTypes[errorTypeName(v.Type())] {
+			continue
+		}
+		f := v.FieldByName("Number")
+		switch f.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(f.Uint()), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return f.Int(), true
+		}
+	}
+	return 0, false
+}
+
+// errorTypeName returns the name of t qualified by its package path
+func errorTypeName(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
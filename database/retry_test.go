@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// mysqlError fakes the *MySQLError of go-sql-driver/mysql
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func init() {
+	numberedErrorTypes[errorTypeName(reflect.TypeOf(mysqlError{}))] = true
+}
+
+// numberError is not a driver error, its Number is not a server error number
+type numberError struct {
+	Number int
+}
+
+func (e *numberError) Error() string {
+	return fmt.Sprintf("number %d", e.Number)
+}
+
+func (e *mysqlError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+type mssqlError struct {
+	Number  int32
+	Message string
+}
+
+func (e mssqlError) Error() string {
+	return "mssql: " + e.Message
+}
+
+func (e mssqlError) SQLErrorNumber() int32 {
+	return e.Number
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"TestIsTransientError_Nil", nil, false},
+		{"TestIsTransientError_BadConn", driver.ErrBadConn, true},
+		{"TestIsTransientError_WrappedBadConn", fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{"TestIsTransientError_MySQLDeadlock", &mysqlError{Number: 1213, Message: "Deadlock found"}, true},
+		{"TestIsTransientError_MySQLLockWait", &mysqlError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{"TestIsTransientError_MySQLDuplicate", &mysqlError{Number: 1062, Message: "Duplicate entry"}, false},
+		{"TestIsTransientError_MsSQLDeadlock", mssqlError{Number: 1205, Message: "deadlocked"}, true},
+		{"TestIsTransientError_OtherNumber", &numberError{Number: 1213}, false},
+		{"TestIsTransientError_DeadlineExceeded", context.DeadlineExceeded, false},
+		{"TestIsTransientError_NoRows", sql.ErrNoRows, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryWrapper_WrapExecContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "TestRetryWrapper_WrapExecContext_Idempotent",
+			ctx:          ContextWithIdempotent(context.TODO()),
+			errs:         []error{driver.ErrBadConn, &mysqlError{Number: 1213}},
+			wantAttempts: 3,
+		},
+		{
+			name:         "TestRetryWrapper_WrapExecContext_NotIdempotent",
+			ctx:          context.TODO(),
+			errs:         []error{driver.ErrBadConn},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "TestRetryWrapper_WrapExecContext_NotTransient",
+			ctx:          ContextWithIdempotent(context.TODO()),
+			errs:         []error{&mysqlError{Number: 1062}},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "TestRetryWrapper_WrapExecContext_Transaction",
+			ctx:          ContextWithTransaction(ContextWithIdempotent(context.TODO())),
+			errs:         []error{&mysqlError{Number: 1213}},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "TestRetryWrapper_WrapExecContext_OutOfAttempts",
+			ctx:          ContextWithIdempotent(context.TODO()),
+			errs:         []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return nil, tt.errs[attempts-1]
+				}
+				return sqlmock.NewResult(0, 1), nil
+			})
+			wp := NewRetryWrapper(WithRetryBackoff(time.Millisecond, time.Millisecond))
+			_, err := wp.WrapExecContext(fn, "UPDATE a SET b = ?", 1)(tt.ctx, "UPDATE a SET b = ?", 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WrapExecContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("WrapExecContext() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryWrapper_WrapQueryContext(t *testing.T) {
+	mt := opentracing.GlobalTracer().(*mocktracer.MockTracer)
+	mt.Reset()
+	parent := mt.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.TODO(), parent)
+
+	attempts := 0
+	fn := QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, driver.ErrBadConn
+		}
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+		return db.QueryContext(ctx, query, args...)
+	})
+	rows, err := NewRetryWrapper(WithRetryBackoff(time.Millisecond, time.Millisecond)).
+		WrapQueryContext(fn, "SELECT a FROM b")(ctx, "SELECT a FROM b")
+	if err != nil {
+		t.Fatalf("WrapQueryContext() error = %v", err)
+	}
+	rows.Close()
+
+	spans := mt.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("finished spans = %d, want 2", len(spans))
+	}
+	for i, span := range spans {
+		if span.ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+			t.Errorf("span %d is not a child of the context span", i)
+		}
+		if got := span.Tag("retry.attempt"); got != i+1 {
+			t.Errorf("span %d retry.attempt = %v, want %d", i, got, i+1)
+		}
+	}
+}
+
+func TestRetryWrapper_ContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	fn := QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		attempts++
+		return nil, driver.ErrBadConn
+	})
+	_, err := NewRetryWrapper(WithRetryBackoff(time.Second, time.Second)).
+		WrapQueryContext(fn, "SELECT a FROM b")(ctx, "SELECT a FROM b")
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("WrapQueryContext() error = %v, want %v", err, driver.ErrBadConn)
+	}
+	if attempts != 1 {
+		t.Errorf("WrapQueryContext() attempts = %d, want 1", attempts)
+	}
+}
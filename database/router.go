@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	defaultReadYourWritesWindow = time.Second
+)
+
+const (
+	routePrimary = "primary"
+	routeReplica = "replica"
+)
+
+// readVerbs are the statements which can be served by replicas
+var readVerbs = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+}
+
+// ReadWriteRouter defines a routing wrapper
+// which sends the reads to the replicas and everything else to the primary
+type ReadWriteRouter struct {
+	primary  QueryContextFunc
+	replicas []QueryContextFunc
+	window   time.Duration
+	next     uint64
+}
+
+// ReadWriteRouterOption defines the router's option
+type ReadWriteRouterOption func(*ReadWriteRouter)
+
+// WithReadYourWritesWindow sets how long the reads stay on the primary after a write in the same session
+func WithReadYourWritesWindow(d time.Duration) ReadWriteRouterOption {
+	return func(r *ReadWriteRouter) {
+		r.window = d
+	}
+}
+
+// NewReadWriteRouter new a read/write router, the replicas are picked in turn
+func NewReadWriteRouter(primary QueryContextFunc, replicas []QueryContextFunc, options ...ReadWriteRouterOption) *ReadWriteRouter {
+	r := &ReadWriteRouter{
+		primary:  primary,
+		replicas: replicas,
+		window:   defaultReadYourWritesWindow,
+	}
+	for _, op := range options {
+		op(r)
+	}
+	return r
+}
+
+type (
+	forcePrimaryKey   struct{}
+	transactionKey    struct{}
+	routingSessionKey struct{}
+)
+
+// ContextWithPrimary routes all statements called with the returned context to the primary
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+// ContextWithTransaction marks the statements called with the returned context as part of a transaction,
+// they are routed to the primary and never retried by the RetryWrapper
+func ContextWithTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionKey{}, true)
+}
+
+func isTransaction(ctx context.Context) bool {
+	return ctx.Value(transactionKey{}) != nil
+}
+
+// ContextWithRoutingSession starts a routing session, usually one per request.
+// Once a write is made in the session, its reads go to the primary for the read-your-writes window.
+func ContextWithRoutingSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routingSessionKey{}, &routingSession{})
+}
+
+type routingSession struct {
+	lastWrite time.Time
+	sync.Mutex
+}
+
+func (s *routingSession) wrote(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastWrite = now
+}
+
+func (s *routingSession) wroteWithin(now time.Time, window time.Duration) bool {
+	s.Lock()
+	defer s.Unlock()
+	return !s.lastWrite.IsZero() && now.Sub(s.lastWrite) < window
+}
+
+func routingSessionFromContext(ctx context.Context) *routingSession {
+	s, _ := ctx.Value(routingSessionKey{}).(*routingSession)
+	return s
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+// fn is used as the primary when the router is built without one.
+func (r *ReadWriteRouter) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	primary := r.primary
+	if primary == nil {
+		primary = fn
+	}
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		route, reason := r.route(ctx, query)
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag("db.route", route)
+			span.SetTag("db.route.reason", reason)
+		}
+		if route == routeReplica {
+			return r.replica()(ctx, query, args...)
+		}
+		rows, err := primary(ctx, query, args...)
+		if reason == "write" && err == nil {
+			r.wrote(ctx)
+		}
+		return rows, err
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+// Execs always go to fn, and start the read-your-writes window of the session.
+func (r *ReadWriteRouter) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag("db.route", routePrimary)
+			span.SetTag("db.route.reason", "write")
+		}
+		res, err := fn(ctx, query, args...)
+		if err == nil {
+			r.wrote(ctx)
+		}
+		return res, err
+	}
+}
+
+// route returns where query goes and why
+func (r *ReadWriteRouter) route(ctx context.Context, query string) (string, string) {
+	switch {
+	case len(r.replicas) == 0:
+		return routePrimary, "no replica"
+	case ctx.Value(forcePrimaryKey{}) != nil:
+		return routePrimary, "forced"
+	case isTransaction(ctx):
+		return routePrimary, "transaction"
+	case !readVerbs[statementVerb(query)]:
+		return routePrimary, "write"
+	case isLockingRead(query):
+		return routePrimary, "locking read"
+	}
+	if s := routingSessionFromContext(ctx); s != nil && s.wroteWithin(time.Now(), r.window) {
+		return routePrimary, "read your writes"
+	}
+	return routeReplica, "read"
+}
+
+func (r *ReadWriteRouter) replica() QueryContextFunc {
+	n := atomic.AddUint64(&r.next, 1)
+	return r.replicas[n%uint64(len(r.replicas))]
+}
+
+func (r *ReadWriteRouter) wrote(ctx context.Context) {
+	if s := routingSessionFromContext(ctx); s != nil {
+		s.wrote(time.Now())
+	}
+}
+
+// isLockingRead reports whether query is a SELECT ... FOR UPDATE or LOCK IN SHARE MODE
+func isLockingRead(query string) bool {
+	tokens := tokenize(query)
+	for i := 1; i < len(tokens); i++ {
+		switch tokens[i].upper() {
+		case "UPDATE":
+			if tokens[i-1].upper() == "FOR" {
+				return true
+			}
+		case "SHARE":
+			if tokens[i-1].upper() == "FOR" || tokens[i-1].upper() == "IN" {
+				return true
+			}
+		case "UPDLOCK", "HOLDLOCK", "XLOCK":
+			return true
+		}
+	}
+	return false
+}
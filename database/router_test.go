@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestReadWriteRouter_WrapQueryContext(t *testing.T) {
+	var routed string
+	queryFunc := func(name string) QueryContextFunc {
+		return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+			routed = name
+			return nil, nil
+		}
+	}
+	router := NewReadWriteRouter(queryFunc(routePrimary), []QueryContextFunc{queryFunc(routeReplica)},
+		WithReadYourWritesWindow(time.Minute))
+
+	session := ContextWithRoutingSession(context.TODO())
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		query      string
+		want       string
+		wantReason string
+	}{
+		{"TestReadWriteRouter_Read", context.TODO(), "SELECT a FROM b", routeReplica, "read"},
+		{"TestReadWriteRouter_Write", context.TODO(), "UPDATE b SET a = 1", routePrimary, "write"},
+		{"TestReadWriteRouter_ForUpdate", context.TODO(), "SELECT a FROM b WHERE c = 1 FOR UPDATE", routePrimary, "locking read"},
+		{"TestReadWriteRouter_Forced", ContextWithPrimary(context.TODO()), "SELECT a FROM b", routePrimary, "forced"},
+		{"TestReadWriteRouter_Transaction", ContextWithTransaction(context.TODO()), "SELECT a FROM b", routePrimary, "transaction"},
+		{"TestReadWriteRouter_SessionRead", session, "SELECT a FROM b", routeReplica, "read"},
+		{"TestReadWriteRouter_SessionWrite", session, "INSERT INTO b (a) VALUES (1)", routePrimary, "write"},
+		{"TestReadWriteRouter_ReadYourWrites", session, "SELECT a FROM b", routePrimary, "read your writes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := opentracing.GlobalTracer().StartSpan("x")
+			ctx := opentracing.ContextWithSpan(tt.ctx, span)
+			router.WrapQueryContext(nil, tt.query)(ctx, tt.query)
+			if routed != tt.want {
+				t.Errorf("routed to %s, want %s", routed, tt.want)
+			}
+			ms := span.(*mocktracer.MockSpan)
+			if got := ms.Tag("db.route"); got != tt.want {
+				t.Errorf("db.route = %v, want %v", got, tt.want)
+			}
+			if got := ms.Tag("db.route.reason"); got != tt.wantReason {
+				t.Errorf("db.route.reason = %v, want %v", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReadWriteRouter_WrapExecContext(t *testing.T) {
+	router := NewReadWriteRouter(nil, []QueryContextFunc{
+		func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+			t.Errorf("read routed to the replica after a write")
+			return nil, nil
+		},
+	})
+	exec := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		return sqlmock.NewResult(0, 1), nil
+	})
+	query := QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		return nil, nil
+	})
+
+	ctx := ContextWithRoutingSession(context.TODO())
+	if _, err := router.WrapExecContext(exec, "UPDATE b SET a = 1")(ctx, "UPDATE b SET a = 1"); err != nil {
+		t.Fatalf("WrapExecContext() error = %v", err)
+	}
+	router.WrapQueryContext(query, "SELECT a FROM b")(ctx, "SELECT a FROM b")
+}
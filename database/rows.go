@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	rowSetDBOnce sync.Once
+	rowSetDB     *sql.DB
+)
+
+// rowSet is a materialized result set, which can be served as *sql.Rows again
+type rowSet struct {
+	columns []string
+	rows    [][]driver.Value
+	// err is returned once all rows are read, nil means the result set ends normally
+	err error
+}
+
+// materializeRows reads all rows into a rowSet and closes rows
+func materializeRows(rows *sql.Rows) (*rowSet, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	set := &rowSet{columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]driver.Value, len(columns))
+		for i, v := range values {
+			row[i] = v
+		}
+		set.rows = append(set.rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return set, rows.Close()
+}
+
+// open serves the result set as *sql.Rows, it can be opened any number of times
+func (s *rowSet) open(ctx context.Context) (*sql.Rows, error) {
+	rowSetDBOnce.Do(func() {
+		rowSetDB = sql.OpenDB(rowSetConnector{})
+	})
+	return rowSetDB.QueryContext(ctx, "", s)
+}
+
+// rowSetConnector connects to an in-process driver which only serves the rowSet passed as the query arg
+type rowSetConnector struct{}
+
+func (c rowSetConnector) Connect(context.Context) (driver.Conn, error) {
+	return rowSetConn{}, nil
+}
+
+func (c rowSetConnector) Driver() driver.Driver {
+	return rowSetDriver{}
+}
+
+type rowSetDriver struct{}
+
+func (d rowSetDriver) Open(string) (driver.Conn, error) {
+	return rowSetConn{}, nil
+}
+
+type rowSetConn struct{}
+
+func (c rowSetConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("database: materialized rows can not be prepared")
+}
+
+func (c rowSetConn) Close() error {
+	return nil
+}
+
+func (c rowSetConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("database: materialized rows can not begin a transaction")
+}
+
+// CheckNamedValue accepts the *rowSet arg as it is
+func (c rowSetConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c rowSetConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errors.New("database: materialized rows are missing")
+	}
+	set, ok := args[0].Value.(*rowSet)
+	if !ok {
+		return nil, errors.New("database: materialized rows are missing")
+	}
+	return &rowSetRows{set: set}, nil
+}
+
+type rowSetRows struct {
+	set  *rowSet
+	next int
+}
+
+func (r *rowSetRows) Columns() []string {
+	return r.set.columns
+}
+
+func (r *rowSetRows) Close() error {
+	return nil
+}
+
+func (r *rowSetRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.set.rows) {
+		if r.set.err != nil {
+			return r.set.err
+		}
+		return io.EOF
+	}
+	for i, v := range r.set.rows[r.next] {
+		// the row may be served again, so the callers must not share its buffers
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
+
+// result is a sql.Result made without a database
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShadowSampleRate  = 0.01
+	defaultShadowTimeout     = 5 * time.Second
+	defaultShadowConcurrency = 8
+)
+
+// ShadowMismatch reports a sampled read whose result sets differ between the primary and the secondary
+type ShadowMismatch struct {
+	Statement     string
+	PrimaryRows   int
+	SecondaryRows int
+	// Summary describes the first differences, such as "row 3 column name: \"a\" != \"b\""
+	Summary string
+}
+
+// ShadowReadWrapper defines a shadow read wrapper for database migrations
+// which mirrors a sample of the reads to a secondary database and compares the result sets in background.
+// The sampled primary rows are materialized before they are returned, the other reads are not touched.
+type ShadowReadWrapper struct {
+	secondary  QueryContextFunc
+	sampleRate float64
+	timeout    time.Duration
+	slots      chan struct{}
+	onMismatch func(ShadowMismatch)
+	logger     Logger
+}
+
+// ShadowReadOption defines the shadow read wrapper's option
+type ShadowReadOption func(*ShadowReadWrapper)
+
+// WithShadowSampleRate sets the ratio of the reads mirrored to the secondary, from 0 to 1
+func WithShadowSampleRate(rate float64) ShadowReadOption {
+	return func(w *ShadowReadWrapper) {
+		w.sampleRate = rate
+	}
+}
+
+// WithShadowTimeout sets the timeout of the secondary reads
+func WithShadowTimeout(d time.Duration) ShadowReadOption {
+	return func(w *ShadowReadWrapper) {
+		if d > 0 {
+			w.timeout = d
+		}
+	}
+}
+
+// WithShadowConcurrency sets how many comparisons can run at the same time,
+// a sampled read is not mirrored when all of them are busy
+func WithShadowConcurrency(n int) ShadowReadOption {
+	return func(w *ShadowReadWrapper) {
+		if n > 0 {
+			w.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithShadowMismatchHandler passes the mismatches to fn instead of logging them
+func WithShadowMismatchHandler(fn func(ShadowMismatch)) ShadowReadOption {
+	return func(w *ShadowReadWrapper) {
+		w.onMismatch = fn
+	}
+}
+
+// WithShadowLogger logs the mismatches and the secondary errors to l instead of the standard logger
+func WithShadowLogger(l Logger) ShadowReadOption {
+	return func(w *ShadowReadWrapper) {
+		w.logger = l
+	}
+}
+
+// NewShadowReadWrapper new a shadow read wrapper mirroring to secondary,
+// by default 1% of the reads are mirrored with 8 comparisons at most at the same time
+func NewShadowReadWrapper(secondary QueryContextFunc, options ...ShadowReadOption) *ShadowReadWrapper {
+	w := &ShadowReadWrapper{
+		secondary:  secondary,
+		sampleRate: defaultShadowSampleRate,
+		timeout:    defaultShadowTimeout,
+		slots:      make(chan struct{}, defaultShadowConcurrency),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+func (w *ShadowReadWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		if !w.sample(query) {
+			return fn(ctx, query, args...)
+		}
+		rows, err := fn(ctx, query, args...)
+		if err != nil {
+			<-w.slots
+			return nil, err
+		}
+		set, err := materializeRows(rows)
+		if err != nil {
+			<-w.slots
+			return nil, err
+		}
+		go func() {
+			defer func() { <-w.slots }()
+			w.compare(set, query, args)
+		}()
+		return set.open(ctx)
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext, the execs are never mirrored
+func (w *ShadowReadWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return fn
+}
+
+// sample reports whether the query is mirrored, a comparison slot is taken if so
+func (w *ShadowReadWrapper) sample(query string) bool {
+	if w.sampleRate <= 0 || !readVerbs[statementVerb(query)] || rand.Float64() >= w.sampleRate {
+		return false
+	}
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *ShadowReadWrapper) compare(primary *rowSet, query string, args []interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	rows, err := w.secondary(ctx, query, args...)
+	if err == nil {
+		var secondary *rowSet
+		if secondary, err = materializeRows(rows); err == nil {
+			if summary := diffRowSets(primary, secondary); summary != "" {
+				w.report(ShadowMismatch{
+					Statement:     fingerprint(query),
+					PrimaryRows:   len(primary.rows),
+					SecondaryRows: len(secondary.rows),
+					Summary:       summary,
+				})
+			}
+			return
+		}
+	}
+	w.log(fmt.Sprintf("shadow read: %s: %s\n", fingerprint(query), err))
+}
+
+func (w *ShadowReadWrapper) report(m ShadowMismatch) {
+	if w.onMismatch != nil {
+		w.onMismatch(m)
+		return
+	}
+	w.log(fmt.Sprintf("shadow read mismatch: %s: %s\n", m.Statement, m.Summary))
+}
+
+func (w *ShadowReadWrapper) log(msg string) {
+	if w.logger == nil {
+		log.Print(msg)
+		return
+	}
+	w.logger.Log(os.Stderr, msg)
+}
+
+// diffRowSets compares the result sets row by row, and summarizes the first differences, "" means equal
+func diffRowSets(a, b *rowSet) string {
+	if strings.Join(a.columns, ",") != strings.Join(b.columns, ",") {
+		return fmt.Sprintf("columns %v != %v", a.columns, b.columns)
+	}
+	var (
+		diffs   []string
+		diffRow int
+	)
+	for i := 0; i < len(a.rows) && i < len(b.rows); i++ {
+		for j := range a.columns {
+			va, vb := normalizeShadowValue(a.rows[i][j]), normalizeShadowValue(b.rows[i][j])
+			if va == vb {
+				continue
+			}
+			if diffRow++; len(diffs) < 3 {
+				diffs = append(diffs, fmt.Sprintf("row %d column %s: %q != %q", i, a.columns[j], va, vb))
+			}
+			break
+		}
+	}
+	if diffRow > len(diffs) {
+		diffs = append(diffs, fmt.Sprintf("%d more rows differ", diffRow-len(diffs)))
+	}
+	if len(a.rows) != len(b.rows) {
+		diffs = append(diffs, fmt.Sprintf("rows %d != %d", len(a.rows), len(b.rows)))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// normalizeShadowValue renders v so that the values different drivers return for the same data are equal,
+// such as []byte("1") from MySQL and int64(1) from MsSQL
+func normalizeShadowValue(v driver.Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDiffRowSets(t *testing.T) {
+	base := &rowSet{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}}}
+	tests := []struct {
+		name  string
+		other *rowSet
+		want  string
+	}{
+		{
+			name:  "TestDiffRowSets_Equal",
+			other: &rowSet{columns: []string{"id", "name"}, rows: [][]driver.Value{{[]byte("1"), "a"}, {int64(2), "b"}}},
+			want:  "",
+		},
+		{
+			name:  "TestDiffRowSets_Columns",
+			other: &rowSet{columns: []string{"id"}},
+			want:  "columns [id name] != [id]",
+		},
+		{
+			name:  "TestDiffRowSets_Value",
+			other: &rowSet{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), "a"}, {int64(2), nil}}},
+			want:  `row 1 column name: "b" != "NULL"`,
+		},
+		{
+			name:  "TestDiffRowSets_Rows",
+			other: &rowSet{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), "a"}}},
+			want:  "rows 2 != 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffRowSets(base, tt.other); got != tt.want {
+				t.Errorf("diffRowSets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShadowReadWrapper(t *testing.T) {
+	secondary := QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("mock sql conn failed:%v", err.Error())
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, []byte("a")))
+		return db.QueryContext(ctx, query, args...)
+	})
+	mismatches := make(chan ShadowMismatch, 1)
+	wp := NewShadowReadWrapper(secondary,
+		WithShadowSampleRate(1),
+		WithShadowMismatchHandler(func(m ShadowMismatch) { mismatches <- m }),
+	)
+
+	calls := 0
+	query := wp.WrapQueryContext(newCountingQueryFunc(t, &calls), "")
+	if names := queryNames(t, query, "SELECT id, name FROM countries WHERE id > ?", 0); len(names) != 2 {
+		t.Errorf("primary names = %v, want 2 names", names)
+	}
+
+	select {
+	case m := <-mismatches:
+		if m.Statement != "select id, name from countries where id > ?" || m.PrimaryRows != 2 || m.SecondaryRows != 1 {
+			t.Errorf("mismatch = %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("mismatch not reported")
+	}
+}
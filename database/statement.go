@@ -0,0 +1,347 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	inListRegexp       = regexp.MustCompile(`\bin \(\?(?:, ?\?)*\)`)
+	multiValuesRegexp  = regexp.MustCompile(`(\bvalues ?\(\?(?:, ?\?)*\))(?:, ?\(\?(?:, ?\?)*\))+`)
+	tableClauseKeyword = map[string]bool{
+		"WHERE": true, "SET": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true,
+		"OUTER": true, "CROSS": true, "NATURAL": true, "STRAIGHT_JOIN": true, "ON": true,
+		"USING": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+		"UNION": true, "VALUES": true, "VALUE": true, "SELECT": true, "FOR": true,
+		"WITH": true, "LOCK": true, "INTO": true, "OUTPUT": true, "WINDOW": true,
+		"PARTITION": true, "FORCE": true, "USE": true, "IGNORE": true, "DEFAULT": true,
+	}
+)
+
+type tokenKind uint8
+
+const (
+	tokenWord tokenKind = iota + 1
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+// token is a lexical unit of a statement, space records whether whitespaces or comments precede it
+// and pos is its offset in the statement
+type token struct {
+	kind  tokenKind
+	text  string
+	space bool
+	pos   int
+}
+
+// upper returns the upper cased text of a word token, or "" for the other kinds
+func (t token) upper() string {
+	if t.kind != tokenWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// name returns the unquoted name of a word or a quoted identifier
+func (t token) name() string {
+	switch t.kind {
+	case tokenWord:
+		return t.text
+	case tokenIdentifier:
+		return t.text[1 : len(t.text)-1]
+	}
+	return ""
+}
+
+// tokenize splits query into tokens, comments are dropped
+func tokenize(query string) []token {
+	var (
+		tokens []token
+		space  bool
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+			continue
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "--")):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			space = true
+			i += end
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i - 4
+			}
+			space = true
+			i += end + 4
+			continue
+		}
+
+		start, kind := i, tokenPunct
+		switch {
+		case c == '\'' || c == '"':
+			kind = tokenString
+			i = skipQuoted(query, i, c)
+		case c == '`':
+			kind = tokenIdentifier
+			i = skipQuoted(query, i, c)
+		case c == '[':
+			kind = tokenIdentifier
+			if end := strings.IndexByte(query[i:], ']'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			kind = tokenNumber
+			for i < len(query) && (isWordChar(query[i]) || query[i] == '.') {
+				i++
+			}
+		case isWordChar(c):
+			kind = tokenWord
+			for i < len(query) && (isWordChar(query[i]) || (query[i] == '.' && i+1 < len(query) && isWordChar(query[i+1]))) {
+				i++
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, token{kind: kind, text: query[start:i], space: space, pos: start})
+		space = false
+	}
+	return tokens
+}
+
+// skipQuoted returns the index after the quoted text starting at i, both backslash and doubled quote escapes are supported
+func skipQuoted(query string, i int, quote byte) int {
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || isDigit(c) ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// statementVerb returns the upper cased leading keyword of query, such as SELECT or UPDATE
+func statementVerb(query string) string {
+	for _, t := range tokenize(query) {
+		if t.kind == tokenWord {
+			return t.upper()
+		}
+		if t.text != "(" {
+			return ""
+		}
+	}
+	return ""
+}
+
+// splitStatements splits a multi-statement query on the semicolons outside of the parentheses,
+// the statements without any token are dropped
+func splitStatements(query string) []string {
+	var (
+		statements []string
+		depth      int
+		start      int
+		tokens     int
+	)
+	for _, t := range tokenize(query) {
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case t.text == ";" && depth == 0:
+			if tokens > 0 {
+				statements = append(statements, strings.TrimSpace(query[start:t.pos]))
+			}
+			start, tokens = t.pos+1, 0
+			continue
+		}
+		tokens++
+	}
+	if tokens > 0 {
+		statements = append(statements, strings.TrimSpace(query[start:]))
+	}
+	return statements
+}
+
+// fingerprint returns the shape of query, statements which only differ in values share the same fingerprint.
+// Comments are dropped, literals become ?, IN lists and multi-row VALUES collapse,
+// whitespaces are squashed and the result is lower cased.
+// Once applied, "SELECT a FROM b WHERE c IN (1, 2, 'x')" will be "select a from b where c in (?+)"
+func fingerprint(query string) string {
+	var b strings.Builder
+	for i, t := range tokenize(query) {
+		if t.space && i > 0 {
+			b.WriteByte(' ')
+		}
+		switch t.kind {
+		case tokenString, tokenNumber:
+			b.WriteByte('?')
+		default:
+			b.WriteString(strings.ToLower(t.text))
+		}
+	}
+	fp := multiValuesRegexp.ReplaceAllString(b.String(), "$1")
+	return inListRegexp.ReplaceAllString(fp, "in (?+)")
+}
+
+// statementTables returns the lower cased tables query reads from or writes to
+func statementTables(query string) []string {
+	var (
+		tables []string
+		seen   = make(map[string]bool)
+	)
+	add := func(t token) {
+		name := strings.ToLower(t.name())
+		if name != "" && !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+	tokens := tokenize(query)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i].upper() {
+		case "UPDATE":
+			// neither "FOR UPDATE" nor "ON DUPLICATE KEY UPDATE" is followed by tables
+			if i > 0 && (tokens[i-1].upper() == "FOR" || tokens[i-1].upper() == "KEY") {
+				continue
+			}
+			i = scanTableList(tokens, i+1, true, add)
+		case "FROM":
+			i = scanTableList(tokens, i+1, true, add)
+		case "JOIN", "INTO":
+			i = scanTableList(tokens, i+1, false, add)
+		case "TABLE":
+			j := i + 1
+			if j+1 < len(tokens) && tokens[j].upper() == "IF" {
+				j += 2
+			}
+			i = scanTableList(tokens, j, false, add)
+		case "INSERT", "REPLACE", "DELETE":
+			if i+1 < len(tokens) && tokens[i+1].upper() != "INTO" && tokens[i+1].upper() != "FROM" {
+				i = scanTableList(tokens, i+1, false, add)
+			}
+		}
+	}
+	return tables
+}
+
+// scanTableList reads the table names (with optional aliases) starting at tokens[i],
+// it returns the index of the last consumed token
+func scanTableList(tokens []token, i int, list bool, add func(token)) int {
+	for i < len(tokens) {
+		t := tokens[i]
+		if (t.kind != tokenWord && t.kind != tokenIdentifier) || tableClauseKeyword[t.upper()] {
+			return i - 1
+		}
+		add(t)
+		i++
+		if i < len(tokens) && tokens[i].upper() == "AS" {
+			i++
+		}
+		if i < len(tokens) && (tokens[i].kind == tokenIdentifier ||
+			(tokens[i].kind == tokenWord && !tableClauseKeyword[tokens[i].upper()])) {
+			i++
+		}
+		if !list || i >= len(tokens) || tokens[i].text != "," {
+			return i - 1
+		}
+		i++
+	}
+	return i - 1
+}
+
+// hasWhereClause reports whether query has a WHERE clause outside of its subqueries
+func hasWhereClause(query string) bool {
+	depth := 0
+	for _, t := range tokenize(query) {
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case depth == 0 && t.upper() == "WHERE":
+			return true
+		}
+	}
+	return false
+}
+
+// interpolate replaces the ? placeholders outside of the quoted texts with the SQL literals of args.
+// Once applied with "it's" and 1, "UPDATE a SET b = ? WHERE c = ?" will be
+//
+//	UPDATE a SET b = 'it''s' WHERE c = 1
+func interpolate(query string, args []interface{}) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(query, i, c)
+			b.WriteString(query[i:end])
+			i = end - 1
+		case c == '?' && n < len(args):
+			b.WriteString(sqlLiteral(args[n]))
+			n++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sqlLiteral renders arg as a SQL literal, the arg is converted as the driver would do first
+func sqlLiteral(arg interface{}) string {
+	v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		v = fmt.Sprint(arg)
+	}
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	case string:
+		return "'" + strings.ReplaceAll(x, "'", "''") + "'"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(x), "'", "''") + "'"
+	case time.Time:
+		return "'" + x.Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "TestFingerprint_Literals",
+			query: "SELECT a FROM b WHERE c = 'd' AND e = 12.5",
+			want:  "select a from b where c = ? and e = ?",
+		},
+		{
+			name:  "TestFingerprint_Placeholders",
+			query: "SELECT a FROM b WHERE c = ?",
+			want:  "select a from b where c = ?",
+		},
+		{
+			name:  "TestFingerprint_Comments_And_Spaces",
+			query: "/* app */ SELECT a,\n\tb  FROM b -- trailing\nWHERE c = 1",
+			want:  "select a, b from b where c = ?",
+		},
+		{
+			name:  "TestFingerprint_InList",
+			query: "SELECT a FROM b WHERE c IN (1, 2, 'it''s')",
+			want:  "select a from b where c in (?+)",
+		},
+		{
+			name:  "TestFingerprint_MultiValues",
+			query: "INSERT INTO a (b, c) VALUES (1, 'x'), (2, 'y'), (?, ?)",
+			want:  "insert into a (b, c) values (?, ?)",
+		},
+		{
+			name:  "TestFingerprint_Identifiers",
+			query: "SELECT `a1` FROM [b] WHERE c2 = 3",
+			want:  "select `a1` from [b] where c2 = ?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fingerprint(tt.query); got != tt.want {
+				t.Errorf("fingerprint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1; DROP TABLE users;", []string{"SELECT 1", "DROP TABLE users"}},
+		{"SELECT ';' FROM a /* ; */; DELETE FROM b", []string{"SELECT ';' FROM a /* ; */", "DELETE FROM b"}},
+		{"SELECT 1; -- ;", []string{"SELECT 1"}},
+		{";;", nil},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitStatements(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStatementVerb(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select a from b", "SELECT"},
+		{"  /* x */ UPDATE a SET b = 1", "UPDATE"},
+		{"(SELECT a FROM b) UNION (SELECT a FROM c)", "SELECT"},
+		{"-- comment\ndelete from a", "DELETE"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := statementVerb(tt.query); got != tt.want {
+			t.Errorf("statementVerb(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStatementTables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT a FROM b WHERE c = ?", []string{"b"}},
+		{"SELECT x.a FROM b AS x, db.c y JOIN `d` ON d.id = y.id", []string{"b", "db.c", "d"}},
+		{"SELECT a FROM (SELECT a FROM b) t WHERE a IN (SELECT a FROM c)", []string{"b", "c"}},
+		{"UPDATE a SET b = 1 WHERE c = 2", []string{"a"}},
+		{"INSERT INTO a (b) VALUES (1) ON DUPLICATE KEY UPDATE b = 1", []string{"a"}},
+		{"DELETE FROM [a] WHERE b = 1", []string{"a"}},
+		{"TRUNCATE TABLE a", []string{"a"}},
+		{"DROP TABLE IF EXISTS a", []string{"a"}},
+		{"SELECT a FROM b WHERE c = 1 FOR UPDATE", []string{"b"}},
+	}
+	for _, tt := range tests {
+		if got := statementTables(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("statementTables(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHasWhereClause(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"UPDATE a SET b = 1 WHERE c = 2", true},
+		{"UPDATE a SET b = 1", false},
+		{"DELETE FROM a WHERE b IN (SELECT b FROM c)", true},
+		{"DELETE FROM a WHERE b IN (SELECT b FROM c WHERE d = 1)", true},
+		{"UPDATE a SET b = (SELECT b FROM c WHERE d = 1)", false},
+		{"DELETE FROM a -- WHERE b = 1", false},
+		{"UPDATE a SET b = 'WHERE'", false},
+	}
+	for _, tt := range tests {
+		if got := hasWhereClause(tt.query); got != tt.want {
+			t.Errorf("hasWhereClause(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"UPDATE a SET b = ? WHERE c = ?", []interface{}{"it's", 1}, "UPDATE a SET b = 'it''s' WHERE c = 1"},
+		{"UPDATE a SET b = '?' WHERE c = ?", []interface{}{nil}, "UPDATE a SET b = '?' WHERE c = NULL"},
+		{"UPDATE a SET b = ?, c = ?", []interface{}{true, 1.5}, "UPDATE a SET b = 1, c = 1.5"},
+		{"DELETE FROM a WHERE b = ?", nil, "DELETE FROM a WHERE b = ?"},
+	}
+	for _, tt := range tests {
+		if got := interpolate(tt.query, tt.args); got != tt.want {
+			t.Errorf("interpolate(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
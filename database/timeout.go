@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// TimeoutWrapper defines a timeout wrapper
+// which applies a default deadline to the statements whose context has none or a longer one
+type TimeoutWrapper struct {
+	defaultTimeout time.Duration
+	verbs          map[string]time.Duration
+	patterns       []timeoutPattern
+}
+
+type timeoutPattern struct {
+	pattern *regexp.Regexp
+	timeout time.Duration
+}
+
+// TimeoutOption defines the timeout wrapper's option
+type TimeoutOption func(*TimeoutWrapper)
+
+// WithDefaultTimeout sets the timeout of the statements matching neither a pattern nor a verb
+func WithDefaultTimeout(d time.Duration) TimeoutOption {
+	return func(w *TimeoutWrapper) {
+		w.defaultTimeout = d
+	}
+}
+
+// WithVerbTimeout sets the timeout of the statements starting with verb, such as "SELECT" or "UPDATE".
+// A SELECT timeout holds a timer per query until it fires, see NewTimeoutWrapper.
+func WithVerbTimeout(verb string, d time.Duration) TimeoutOption {
+	return func(w *TimeoutWrapper) {
+		w.verbs[strings.ToUpper(verb)] = d
+	}
+}
+
+// WithPatternTimeout sets the timeout of the statements whose fingerprint matches pattern.
+// The fingerprint is lower cased with the literals replaced by ?, such as "select a from b where c = ?".
+// Patterns are matched in the order they are added, and take precedence over the verbs.
+// Keep the timeouts of the matched queries short, their timers are not stopped when the rows are closed.
+func WithPatternTimeout(pattern *regexp.Regexp, d time.Duration) TimeoutOption {
+	return func(w *TimeoutWrapper) {
+		w.patterns = append(w.patterns, timeoutPattern{pattern: pattern, timeout: d})
+	}
+}
+
+// NewTimeoutWrapper new a timeout wrapper, the statements matching no option are not limited.
+// The deadline of a successful query can not be canceled before its rows are read, so its timer and context
+// are only released when the deadline passes. Under a high query rate, a query timeout of minutes keeps
+// rate * timeout of them alive, give the queries timeouts of seconds and the long reports their own context deadline.
+func NewTimeoutWrapper(options ...TimeoutOption) *TimeoutWrapper {
+	w := &TimeoutWrapper{
+		verbs: make(map[string]time.Duration),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+// WrapQueryContext impls wrapper's WrapQueryContext
+// The imposed deadline is not canceled on success, since the returned rows are read with the context.
+// It is released once the deadline passes.
+func (w *TimeoutWrapper) WrapQueryContext(fn QueryContextFunc, query string, args ...interface{}) QueryContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		ctx, cancel := w.withTimeout(ctx, query)
+		rows, err := fn(ctx, query, args...)
+		if err != nil {
+			cancel()
+		}
+		return rows, err
+	}
+}
+
+// WrapExecContext impls wrapper's WrapExecContext
+func (w *TimeoutWrapper) WrapExecContext(fn ExecContextFunc, query string, args ...interface{}) ExecContextFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		ctx, cancel := w.withTimeout(ctx, query)
+		defer cancel()
+		return fn(ctx, query, args...)
+	}
+}
+
+// timeout returns the timeout of query, patterns go first, then verbs and the default timeout
+func (w *TimeoutWrapper) timeout(query string) time.Duration {
+	if len(w.patterns) > 0 {
+		fp := fingerprint(query)
+		for _, p := range w.patterns {
+			if p.pattern.MatchString(fp) {
+				return p.timeout
+			}
+		}
+	}
+	if d, ok := w.verbs[statementVerb(query)]; ok {
+		return d
+	}
+	return w.defaultTimeout
+}
+
+// withTimeout returns ctx with the timeout of query, when ctx has no deadline or a later one.
+// The span in ctx is tagged once the timeout is imposed.
+func (w *TimeoutWrapper) withTimeout(ctx context.Context, query string) (context.Context, context.CancelFunc) {
+	d := w.timeout(query)
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return ctx, func() {}
+	}
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag("db.timeout", d.String())
+		span.SetTag("db.timeout.imposed", true)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTimeoutWrapper_WrapExecContext(t *testing.T) {
+	wp := NewTimeoutWrapper(
+		WithDefaultTimeout(time.Minute),
+		WithVerbTimeout("delete", 10*time.Second),
+		WithPatternTimeout(regexp.MustCompile(`^delete from logs`), time.Hour),
+	)
+	longCtx, cancel := context.WithTimeout(context.TODO(), 2*time.Hour)
+	defer cancel()
+	shortCtx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		query       string
+		wantTimeout time.Duration
+		wantImposed bool
+	}{
+		{"TestTimeoutWrapper_Default", context.TODO(), "UPDATE a SET b = 1", time.Minute, true},
+		{"TestTimeoutWrapper_Verb", context.TODO(), "DELETE FROM a WHERE b = 1", 10 * time.Second, true},
+		{"TestTimeoutWrapper_Pattern", context.TODO(), "DELETE FROM logs WHERE b = 1", time.Hour, true},
+		{"TestTimeoutWrapper_LongerDeadline", longCtx, "UPDATE a SET b = 1", time.Minute, true},
+		{"TestTimeoutWrapper_ShorterDeadline", shortCtx, "UPDATE a SET b = 1", time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := opentracing.GlobalTracer().StartSpan("x")
+			ctx := opentracing.ContextWithSpan(tt.ctx, span)
+			fn := ExecContextFunc(func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+				deadline, ok := ctx.Deadline()
+				if !ok {
+					t.Fatalf("context has no deadline")
+				}
+				if left := time.Until(deadline); left > tt.wantTimeout || left < tt.wantTimeout-time.Second {
+					t.Errorf("deadline in %v, want %v", left, tt.wantTimeout)
+				}
+				return sqlmock.NewResult(0, 1), nil
+			})
+			wp.WrapExecContext(fn, tt.query)(ctx, tt.query)
+			if imposed, _ := span.(*mocktracer.MockSpan).Tag("db.timeout.imposed").(bool); imposed != tt.wantImposed {
+				t.Errorf("db.timeout.imposed = %v, want %v", imposed, tt.wantImposed)
+			}
+		})
+	}
+}
+
+func TestTimeoutWrapper_NoTimeout(t *testing.T) {
+	fn := QueryContextFunc(func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Errorf("context has a deadline, want none")
+		}
+		return nil, sql.ErrNoRows
+	})
+	NewTimeoutWrapper(WithVerbTimeout("UPDATE", time.Second)).
+		WrapQueryContext(fn, "SELECT a FROM b")(context.TODO(), "SELECT a FROM b")
+}